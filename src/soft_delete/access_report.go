@@ -0,0 +1,291 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"github.com/codegangsta/cli"
+	htmltemplate "html/template"
+	"io"
+	"log"
+	"os"
+	"regexp"
+	"soft_delete/driver/database"
+	"soft_delete/models"
+	"sort"
+	"strings"
+	texttemplate "text/template"
+	"time"
+)
+
+var accessReportCommand = cli.Command{
+	Name:  "access-report",
+	Usage: "Write a human readable report of the data held on a user",
+	Flags: []cli.Flag{
+		cli.StringFlag{Name: "user", Usage: "UUID or email of the user"},
+		cli.StringFlag{Name: "format", Value: "md", Usage: "md or html"},
+		cli.StringFlag{Name: "out", Usage: "file to write, stdout if not set"},
+	},
+	Action: accessReportAction,
+}
+
+// Entities whose records describe taking part in the program rather than
+// health measures.
+var programEntities = map[string]bool{
+	"Intake":       true,
+	"Registration": true,
+	"Assessment":   true,
+}
+
+type accessItem struct {
+	Label     string
+	Value     string
+	Source    string
+	Collected time.Time
+}
+
+type accessSection struct {
+	Title   string
+	Purpose string
+	Items   []accessItem
+}
+
+type accessReport struct {
+	UserId    string
+	Generated time.Time
+	Sections  []accessSection
+}
+
+func accessReportAction(c *cli.Context) {
+	if c.String("user") == "" {
+		log.Fatal(errors.New("Error: --user is required"))
+	}
+
+	user, err := findUser(database.App, c.String("user"))
+	if err != nil {
+		log.Fatalf("No User data for %v: %v", c.String("user"), err)
+	}
+
+	graph, err := models.LoadUserGraphWithTx(user.UserId, database.App)
+	if err != nil {
+		log.Fatalf("Error loading data of %v: %v", user.UserId, err)
+	}
+
+	var out io.Writer = os.Stdout
+	if c.String("out") != "" {
+		file, err := os.Create(c.String("out"))
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer file.Close()
+		out = file
+	}
+
+	err = writeAccessReport(out, newAccessReport(graph), c.String("format"))
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+// Group the graph into the categories an access request is answered in.
+func newAccessReport(graph *models.UserGraph) accessReport {
+	identity := accessSection{
+		Title:   "Identity",
+		Purpose: "To identify you and operate your account.",
+	}
+	contact := accessSection{
+		Title:   "Contact",
+		Purpose: "To contact you about the program and send you program materials.",
+	}
+	health := accessSection{
+		Title:   "Health measures",
+		Purpose: "To track your progress and tailor your coaching.",
+	}
+	activity := accessSection{
+		Title:   "Program activity",
+		Purpose: "To run the program, match you with a coach and keep a record of your participation.",
+	}
+
+	user := graph.User
+	identity.Items = append(identity.Items, accessItem{"Display name", user.DisplayName, "Account", user.CreatedAt})
+	for _, key := range sortedKeys(user.Meta) {
+		identity.Items = append(identity.Items, accessItem{key, summarizeValue(user.Meta[key]), "Account profile", user.CreatedAt})
+	}
+
+	for _, email := range graph.Emails {
+		contact.Items = append(contact.Items, accessItem{"Email", email.Email, "Account", email.CreatedAt})
+	}
+	for _, address := range graph.Addresses {
+		parts := []string{address.Name, address.AddressLine1, address.AddressLine2, address.City, address.State, address.Country, address.Zipcode}
+		contact.Items = append(contact.Items, accessItem{"Address", joinNonEmpty(parts, ", "), "Account", address.CreatedAt})
+	}
+
+	for _, record := range graph.Records {
+		item := accessItem{
+			Label:     record.Entity.Name,
+			Value:     measureSummary(record.MeasureData),
+			Source:    fmt.Sprintf("%v / %v (%v)", record.Entity.Name, record.Measure.Name, record.Type.Name),
+			Collected: record.CreatedAt,
+		}
+		if programEntities[record.Entity.Name] {
+			activity.Items = append(activity.Items, item)
+		} else {
+			health.Items = append(health.Items, item)
+		}
+
+		// Answers given on the record, e.g. the name, date of birth and
+		// address on the Intake
+		for _, key := range sortedKeys(record.Meta) {
+			answer := accessItem{key, summarizeValue(record.Meta[key]), record.Entity.Name, record.CreatedAt}
+			if contactKey.MatchString(key) {
+				contact.Items = append(contact.Items, answer)
+			} else {
+				identity.Items = append(identity.Items, answer)
+			}
+		}
+	}
+
+	for _, state := range graph.States {
+		activity.Items = append(activity.Items, accessItem{"State: " + state.Type, state.State, "Program", state.CreatedAt})
+	}
+	for _, userLog := range graph.Logs {
+		activity.Items = append(activity.Items, accessItem{"Log: " + userLog.Name, userLog.Message, "Program", userLog.CreatedAt})
+	}
+	for _, assoc := range graph.Associations {
+		activity.Items = append(activity.Items, accessItem{"Association", assoc.Type, "Program", assoc.CreatedAt})
+	}
+	for _, settings := range graph.Settings {
+		activity.Items = append(activity.Items, accessItem{"Settings", fmt.Sprintf("%v", settings.Preferences), "App settings", settings.CreatedAt})
+	}
+	for _, asset := range graph.Assets {
+		activity.Items = append(activity.Items, accessItem{"File: " + asset.Type, fmt.Sprintf("%v bytes", len(asset.Data)), "Uploads", asset.CreatedAt})
+	}
+
+	return accessReport{
+		UserId:    graph.UserId,
+		Generated: time.Now(),
+		Sections:  []accessSection{identity, contact, health, activity},
+	}
+}
+
+func writeAccessReport(w io.Writer, report accessReport, format string) error {
+	switch format {
+	case "md":
+		return markdownAccessReport.Execute(w, report)
+	case "html":
+		return htmlAccessReport.Execute(w, report)
+	}
+	return fmt.Errorf("Error: unknown format %v, expected md or html", format)
+}
+
+// "key: value unit" for each measure, sorted by key.
+func measureSummary(data models.MeasureInfo) string {
+	keys := make([]string, 0, len(data))
+	for key := range data {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	parts := make([]string, 0, len(keys))
+	for _, key := range keys {
+		measure := data[key]
+		value := measure.StringValue
+		if value == "" {
+			value = fmt.Sprintf("%v", measure.Value)
+		}
+		parts = append(parts, strings.TrimSpace(fmt.Sprintf("%v: %v %v", key, value, measure.UnitShort)))
+	}
+	return strings.Join(parts, "; ")
+}
+
+// Meta keys holding contact details rather than identity
+var contactKey = regexp.MustCompile(`(?i)address|street|city|state|zip|postal|country|phone|email`)
+
+// Longest text shown as is; longer text, and embedded files, are
+// summarised
+const maxValueLength = 200
+
+// A readable rendering of a meta value: nested values are flattened into
+// "key: value" pairs and files or long text are summarised by size.
+func summarizeValue(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		if strings.HasPrefix(v, "data:") {
+			return fmt.Sprintf("embedded file (%v characters)", len(v))
+		}
+		if len(v) > maxValueLength {
+			return fmt.Sprintf("text (%v characters)", len(v))
+		}
+		return v
+	case map[string]interface{}:
+		parts := make([]string, 0, len(v))
+		for _, key := range sortedKeys(v) {
+			parts = append(parts, key+": "+summarizeValue(v[key]))
+		}
+		return strings.Join(parts, "; ")
+	case []interface{}:
+		parts := make([]string, 0, len(v))
+		for _, item := range v {
+			parts = append(parts, summarizeValue(item))
+		}
+		return strings.Join(parts, ", ")
+	}
+	return fmt.Sprintf("%v", value)
+}
+
+func sortedKeys(meta models.Metadata) []string {
+	keys := make([]string, 0, len(meta))
+	for key := range meta {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func joinNonEmpty(parts []string, sep string) string {
+	kept := make([]string, 0, len(parts))
+	for _, part := range parts {
+		if strings.TrimSpace(part) != "" {
+			kept = append(kept, part)
+		}
+	}
+	return strings.Join(kept, sep)
+}
+
+var reportFuncs = map[string]interface{}{
+	"date": func(t time.Time) string { return t.Format("2006-01-02") },
+}
+
+var markdownAccessReport = texttemplate.Must(texttemplate.New("md").Funcs(reportFuncs).Parse(`# Data held on {{.UserId}}
+
+Generated {{date .Generated}}.
+{{range .Sections}}
+## {{.Title}}
+
+Why we hold it: {{.Purpose}}
+{{if .Items}}
+| Item | Value | Source | Collected |
+| --- | --- | --- | --- |
+{{range .Items}}| {{.Label}} | {{.Value}} | {{.Source}} | {{date .Collected}} |
+{{end}}{{else}}
+Nothing held.
+{{end}}{{end}}`))
+
+var htmlAccessReport = htmltemplate.Must(htmltemplate.New("html").Funcs(reportFuncs).Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>Data held on {{.UserId}}</title></head>
+<body>
+<h1>Data held on {{.UserId}}</h1>
+<p>Generated {{date .Generated}}.</p>
+{{range .Sections}}
+<h2>{{.Title}}</h2>
+<p>Why we hold it: {{.Purpose}}</p>
+{{if .Items}}<table border="1" cellpadding="4">
+<tr><th>Item</th><th>Value</th><th>Source</th><th>Collected</th></tr>
+{{range .Items}}<tr><td>{{.Label}}</td><td>{{.Value}}</td><td>{{.Source}}</td><td>{{date .Collected}}</td></tr>
+{{end}}</table>{{else}}<p>Nothing held.</p>{{end}}
+{{end}}
+</body>
+</html>
+`))
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"bytes"
+	"soft_delete/models"
+	"strings"
+	"testing"
+)
+
+func TestAccessReportGroupsRecords(t *testing.T) {
+	graph := &models.UserGraph{
+		UserId: "test-user",
+		User:   models.User{DisplayName: "Ada"},
+		Emails: []models.UserEmail{{Email: "ada@example.com"}},
+		Records: []models.Record{
+			{Entity: models.Entity{Name: "Weight"}, Measure: models.Measure{Name: "weight"}, MeasureData: models.MeasureInfo{"weight": {Value: 70, UnitShort: "kg"}}},
+			{Entity: models.Entity{Name: "Intake"}, Measure: models.Measure{Name: "intake"}, Meta: models.Metadata{"first_name": "Ada", "date_of_birth": "1815-12-10", "address": map[string]interface{}{"city": "London"}}},
+		},
+	}
+
+	report := newAccessReport(graph)
+	counts := make(map[string]int)
+	for _, section := range report.Sections {
+		counts[section.Title] = len(section.Items)
+	}
+	if counts["Identity"] != 3 || counts["Contact"] != 2 || counts["Health measures"] != 1 || counts["Program activity"] != 1 {
+		t.Fatalf("Unexpected section sizes: %v", counts)
+	}
+
+	for _, format := range []string{"md", "html"} {
+		var buf bytes.Buffer
+		err := writeAccessReport(&buf, report, format)
+		if err != nil {
+			t.Fatalf("Error writing %v report: %v", format, err)
+		}
+		if !strings.Contains(buf.String(), "weight: 70 kg") || !strings.Contains(buf.String(), "ada@example.com") || !strings.Contains(buf.String(), "1815-12-10") || !strings.Contains(buf.String(), "city: London") {
+			t.Errorf("%v report missing data:\n%v", format, buf.String())
+		}
+	}
+
+	if writeAccessReport(&bytes.Buffer{}, report, "pdf") == nil {
+		t.Error("Unknown format accepted.")
+	}
+}
+
+func TestSummarizeValue(t *testing.T) {
+	avatar := "data:image/png;base64," + strings.Repeat("A", 5000)
+	if got := summarizeValue(avatar); strings.Contains(got, "AAAA") {
+		t.Errorf("Embedded file dumped: %.80v", got)
+	}
+	if got := summarizeValue(map[string]interface{}{"b": 2, "a": "x"}); got != "a: x; b: 2" {
+		t.Errorf("Unexpected nested summary: %v", got)
+	}
+}
@@ -0,0 +1,288 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"github.com/codegangsta/cli"
+	"github.com/dabfleming/gorm"
+	"io"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"soft_delete/driver/database"
+	"soft_delete/models"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+var serveAdminCommand = cli.Command{
+	Name:  "serve-admin",
+	Usage: "Serve the internal admin API for previews, deletions, restores and quit files",
+	Flags: []cli.Flag{
+		cli.StringFlag{Name: "listen", Value: "127.0.0.1:8091", Usage: "address to listen on"},
+	},
+	Action: serveAdminAction,
+}
+
+// Header carrying the admin's session token
+const sessionHeader = "X-Session-Token"
+
+// Largest quit file accepted
+const maxQuitFileSize = 32 << 20
+
+// Admin requests run as the session's user, set as the process-wide
+// operator while they run, so they run one at a time.
+var adminMu sync.Mutex
+
+// An authenticated admin request handler.
+type adminHandler func(w http.ResponseWriter, r *http.Request, admin models.User)
+
+type listResponse struct {
+	Success bool        `json:"success"`
+	Data    interface{} `json:"data"`
+}
+
+type previewResponse struct {
+	Success bool                      `json:"success"`
+	Counts  models.CascadeCounts      `json:"counts"`
+	Records models.RecordListEnvelope `json:"records"`
+}
+
+type runResponse struct {
+	Success bool           `json:"success"`
+	Source  string         `json:"source"`
+	DryRun  bool           `json:"dry_run"`
+	Totals  map[string]int `json:"totals"`
+	Rows    []RowResult    `json:"rows"`
+}
+
+func serveAdminAction(c *cli.Context) {
+	mux := http.NewServeMux()
+	mux.Handle("/admin/runs", requireAdmin(adminRuns))
+	mux.Handle("/admin/quit-files", requireAdmin(adminQuitFile))
+	mux.Handle("/admin/users/", requireAdmin(adminUser))
+
+	log.Print("Serving admin API on ", c.String("listen"))
+	log.Fatal(http.ListenAndServe(c.String("listen"), mux))
+}
+
+// Authenticate the request's session token against sessions, and require
+// the session's user to be an admin.
+func requireAdmin(handler adminHandler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		admin, err := sessionUser(r.Header.Get(sessionHeader))
+		if err != nil {
+			writeJSON(w, http.StatusUnauthorized, models.ErrorResponse{Error: true, Message: "Invalid session"})
+			return
+		}
+		if !admin.IsAdmin() {
+			writeJSON(w, http.StatusForbidden, models.ErrorResponse{Error: true, Message: "Admin role required"})
+			return
+		}
+		handler(w, r, admin)
+	})
+}
+
+// Returns the user of a live session.
+func sessionUser(token string) (models.User, error) {
+	var user models.User
+	var id models.UUID
+
+	id.Parse(token)
+	if id.UUID == nil {
+		return user, fmt.Errorf("Invalid session token")
+	}
+
+	var session models.Session
+	err := database.App.Where("token = ?", id).First(&session).Error
+	if err != nil {
+		return user, err
+	}
+
+	err = database.App.Where("user_id = ?", session.UserId).First(&user).Error
+	return user, err
+}
+
+// Run fn with the admin as operator.
+func asOperator(admin models.User, fn func()) {
+	adminMu.Lock()
+	defer adminMu.Unlock()
+
+	previous := invocation
+	invocation.Operator = fmt.Sprintf("%v (%v)", admin.DisplayName, admin.UserId)
+	defer func() { invocation = previous }()
+
+	fn()
+}
+
+// GET /admin/runs?limit=n lists the most recent deletion batches.
+func adminRuns(w http.ResponseWriter, r *http.Request, admin models.User) {
+	if r.Method != "GET" {
+		writeJSON(w, http.StatusMethodNotAllowed, models.ErrorResponse{Error: true, Message: "GET the runs"})
+		return
+	}
+
+	limit, err := strconv.Atoi(r.URL.Query().Get("limit"))
+	if err != nil || limit <= 0 {
+		limit = 50
+	}
+
+	batches, err := models.DeletionBatchesWithTx(limit, database.App)
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, models.ErrorResponse{Error: true, Message: "Error listing runs: " + err.Error()})
+		return
+	}
+	writeJSON(w, http.StatusOK, listResponse{Success: true, Data: batches})
+}
+
+// POST /admin/quit-files?dry_run=true runs the uploaded quit CSV ("file"
+// form field) and returns its run report.
+func adminQuitFile(w http.ResponseWriter, r *http.Request, admin models.User) {
+	if r.Method != "POST" {
+		writeJSON(w, http.StatusMethodNotAllowed, models.ErrorResponse{Error: true, Message: "POST a quit file"})
+		return
+	}
+
+	err := r.ParseMultipartForm(maxQuitFileSize)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, models.ErrorResponse{Error: true, Message: "Error reading upload: " + err.Error()})
+		return
+	}
+	upload, header, err := r.FormFile("file")
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, models.ErrorResponse{Error: true, Message: "Missing file: " + err.Error()})
+		return
+	}
+	defer upload.Close()
+
+	dir, err := ioutil.TempDir("", "quit-upload")
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, models.ErrorResponse{Error: true, Message: err.Error()})
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	filename := filepath.Join(dir, filepath.Base(header.Filename))
+	file, err := os.Create(filename)
+	if err == nil {
+		_, err = io.Copy(file, upload)
+		file.Close()
+	}
+	if err != nil {
+		writeJSON(w, http.StatusInternalServerError, models.ErrorResponse{Error: true, Message: "Error saving upload: " + err.Error()})
+		return
+	}
+
+	opts := RunOptions{DryRun: r.URL.Query().Get("dry_run") == "true"}
+	var run *Run
+	asOperator(admin, func() {
+		run, err = softDeleteQuitList(filename, opts)
+	})
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, models.ErrorResponse{Error: true, Message: err.Error()})
+		return
+	}
+	run.notifyEmployers()
+
+	writeJSON(w, http.StatusOK, runResponse{
+		Success: true,
+		Source:  header.Filename,
+		DryRun:  opts.DryRun,
+		Totals:  run.Report.Totals(),
+		Rows:    run.Report.Rows,
+	})
+}
+
+// GET /admin/users/{id or email}/preview
+// POST /admin/users/{id or email}/delete
+// POST /admin/users/{id or email}/restore?admin=true
+func adminUser(w http.ResponseWriter, r *http.Request, admin models.User) {
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, "/admin/users/"), "/"), "/")
+	if len(parts) != 2 {
+		writeJSON(w, http.StatusNotFound, models.ErrorResponse{Error: true, Message: "Not found"})
+		return
+	}
+
+	user, err := findUser(database.App, parts[0])
+	if err != nil {
+		writeJSON(w, http.StatusNotFound, models.ErrorResponse{Error: true, Message: fmt.Sprintf("No User data for %v", parts[0])})
+		return
+	}
+
+	switch {
+	case parts[1] == "preview" && r.Method == "GET":
+		adminPreview(w, user)
+	case parts[1] == "delete" && r.Method == "POST":
+		adminDelete(w, user, admin)
+	case parts[1] == "restore" && r.Method == "POST":
+		var err error
+		asOperator(admin, func() {
+			// requireAdmin has checked the role; ?admin=true only confirms
+			// the caller means to undo a finalized deletion
+			err = restoreUser(user.UserId.String(), func() error {
+				if r.URL.Query().Get("admin") != "true" {
+					return errors.New("restoring it requires ?admin=true")
+				}
+				return nil
+			})
+		})
+		if err != nil {
+			writeJSON(w, http.StatusConflict, models.ErrorResponse{Error: true, Message: err.Error()})
+			return
+		}
+		writeJSON(w, http.StatusOK, models.SuccessResponse{Success: true, Message: "Restored " + user.UserId.String()})
+	default:
+		writeJSON(w, http.StatusNotFound, models.ErrorResponse{Error: true, Message: "Not found"})
+	}
+}
+
+// Run the cascade and roll it back, reporting what it would have deleted.
+func adminPreview(w http.ResponseWriter, user models.User) {
+	var records []models.Record
+	err := database.App.Where("user_id = ?", user.UserId).Preload("Entity").Order("record_at").Find(&records).Error
+	if err != nil && err != gorm.RecordNotFound {
+		writeJSON(w, http.StatusInternalServerError, models.ErrorResponse{Error: true, Message: err.Error()})
+		return
+	}
+
+	app := database.App.Begin()
+	counts, err := user.SoftDeleteWithTx(nil, app)
+	app.Rollback()
+	if err != nil {
+		writeJSON(w, http.StatusConflict, models.ErrorResponse{Error: true, Message: err.Error()})
+		return
+	}
+
+	writeJSON(w, http.StatusOK, previewResponse{
+		Success: true,
+		Counts:  counts,
+		Records: models.RecordListEnvelope{Records: len(records), Type: "record", Data: records},
+	})
+}
+
+func adminDelete(w http.ResponseWriter, user models.User, admin models.User) {
+	var outcome string
+	var err error
+	asOperator(admin, func() {
+		var run *Run
+		run, err = NewRun("admin-api", RunOptions{})
+		if err != nil {
+			return
+		}
+
+		app := database.App.Begin()
+		if app.Error != nil {
+			err = app.Error
+			return
+		}
+		outcome, err = run.commitDeletion(app, user, models.Metadata{})
+	})
+	if err != nil {
+		writeJSON(w, http.StatusConflict, models.ErrorResponse{Error: true, Message: fmt.Sprintf("%v (%v)", err, outcome)})
+		return
+	}
+	writeJSON(w, http.StatusOK, models.SuccessResponse{Success: true, Message: fmt.Sprintf("Soft-deleted %v (%v)", user.UserId, outcome)})
+}
@@ -0,0 +1,26 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"soft_delete/models"
+	"testing"
+)
+
+func TestAdminRequiresSession(t *testing.T) {
+	called := false
+	handler := requireAdmin(func(w http.ResponseWriter, r *http.Request, admin models.User) {
+		called = true
+	})
+
+	for _, token := range []string{"", "not-a-uuid"} {
+		req := httptest.NewRequest("GET", "/admin/runs", nil)
+		req.Header.Set(sessionHeader, token)
+		w := httptest.NewRecorder()
+
+		handler.ServeHTTP(w, req)
+		if w.Code != http.StatusUnauthorized || called {
+			t.Fatalf("Expected token %q to be refused, got %v", token, w.Code)
+		}
+	}
+}
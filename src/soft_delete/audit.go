@@ -0,0 +1,73 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"github.com/codegangsta/cli"
+	"github.com/dabfleming/gorm"
+	"io"
+	"log"
+	"os"
+	"soft_delete/driver/database"
+	"soft_delete/models"
+)
+
+var auditCommand = cli.Command{
+	Name:  "audit",
+	Usage: "Work with the audit trail of deletions and restores",
+	Subcommands: []cli.Command{
+		{
+			Name:   "verify",
+			Usage:  "Check the hash chain of the audit trail",
+			Action: auditVerifyAction,
+		},
+	},
+}
+
+func auditVerifyAction(c *cli.Context) {
+	checked, broken, err := models.VerifyAuditChainWithTx(database.App)
+	if err != nil {
+		log.Fatal("Error reading audit trail: ", err)
+	}
+	if broken != nil {
+		log.Fatalf("Audit trail broken after %v good entries: %v", checked, broken)
+	}
+	log.Print("Audit trail intact, ", checked, " entries checked")
+}
+
+// Append an audit entry for action on userId within app, stamped with who
+// is running this and where. Refused if the operator is unknown.
+func audit(app *gorm.DB, action, source, inputHash string, userId models.UUID, counts models.CascadeCounts) error {
+	err := invocation.Check()
+	if err != nil {
+		return err
+	}
+
+	entry := models.AuditEntry{
+		Action:    action,
+		Operator:  invocation.Operator,
+		Host:      invocation.Host,
+		BuildId:   invocation.BuildId,
+		Source:    source,
+		InputHash: inputHash,
+		UserId:    userId,
+		Counts:    counts.Metadata(),
+	}
+	return models.AppendAuditEntryWithTx(&entry, app)
+}
+
+// Hex sha256 of the file's contents.
+func fileHash(filename string) (string, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	_, err = io.Copy(hash, file)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hash.Sum(nil)), nil
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"github.com/codegangsta/cli"
+	"github.com/dabfleming/gorm"
+	"log"
+	"soft_delete/driver/database"
+	"soft_delete/models"
+	"sort"
+)
+
+var checkCommand = cli.Command{
+	Name:  "check",
+	Usage: "Find users left partially soft deleted (or partially restored) and optionally fix them",
+	Flags: []cli.Flag{
+		cli.BoolFlag{Name: "fix", Usage: "complete each partial deletion, or partial restore, found"},
+		cli.BoolFlag{Name: "fix-orphans", Usage: "with --fix, also undelete rows guessed to be left deleted by a failed cascade"},
+	},
+	Action: checkAction,
+}
+
+func checkAction(c *cli.Context) {
+	if c.Bool("fix") {
+		err := invocation.Check()
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	findings, err := models.CheckConsistencyWithTx(database.App)
+	if err != nil {
+		log.Fatal("Error checking consistency: ", err)
+	}
+
+	for _, finding := range findings {
+		log.Printf("%v: user %v, %v row(s) %v", finding.Category, finding.UserId, finding.Table, finding.RowIds)
+	}
+	logFindingTotals(findings)
+	if len(findings) == 0 || !c.Bool("fix") {
+		return
+	}
+
+	groups := findingsByUser(fixableFindings(findings, c.Bool("fix-orphans")))
+	fixed := 0
+	for _, group := range groups {
+		err = inTransaction(func(app *gorm.DB) error {
+			return fixFindings(app, group)
+		})
+		if err != nil {
+			log.Print("Error fixing user ", group[0].UserId, " ~ Err: ", err)
+			continue
+		}
+		fixed++
+	}
+	log.Print("Fixed ", fixed, " of ", len(groups), " user(s)")
+}
+
+// Fix one user's findings within app and audit the repair with the rows
+// fixed per table.
+func fixFindings(app *gorm.DB, findings []models.ConsistencyFinding) error {
+	counts := models.CascadeCounts{}
+	for _, finding := range findings {
+		err := finding.FixWithTx(app)
+		if err != nil {
+			return err
+		}
+		counts[finding.Table] += int64(len(finding.RowIds))
+	}
+	return audit(app, models.AuditActionRepair, "check", "", findings[0].UserId, counts)
+}
+
+// Log the number of findings and rows in each category.
+func logFindingTotals(findings []models.ConsistencyFinding) {
+	users := make(map[string]int)
+	rows := make(map[string]int)
+	for _, finding := range findings {
+		users[finding.Category]++
+		rows[finding.Category] += len(finding.RowIds)
+	}
+
+	categories := make([]string, 0, len(users))
+	for category := range users {
+		categories = append(categories, category)
+	}
+	sort.Strings(categories)
+
+	log.Printf("Found %v inconsistencies", len(findings))
+	for _, category := range categories {
+		log.Printf("\t%v: %v row(s) across %v user(s)", category, rows[category], users[category])
+	}
+}
+
+// The findings --fix acts on. Guessed ones are left for someone to look at
+// unless fixOrphans is set.
+func fixableFindings(findings []models.ConsistencyFinding, fixOrphans bool) []models.ConsistencyFinding {
+	fixable := make([]models.ConsistencyFinding, 0, len(findings))
+	for _, finding := range findings {
+		if finding.Guessed() && !fixOrphans {
+			log.Printf("Not fixing %v of user %v without --fix-orphans", finding.Category, finding.UserId)
+			continue
+		}
+		fixable = append(fixable, finding)
+	}
+	return fixable
+}
+
+// Findings grouped by user, in the order the users were first found.
+func findingsByUser(findings []models.ConsistencyFinding) [][]models.ConsistencyFinding {
+	index := make(map[string]int)
+	groups := make([][]models.ConsistencyFinding, 0)
+	for _, finding := range findings {
+		key := finding.UserId.String()
+		i, ok := index[key]
+		if !ok {
+			i = len(groups)
+			index[key] = i
+			groups = append(groups, nil)
+		}
+		groups[i] = append(groups[i], finding)
+	}
+	return groups
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"soft_delete/models"
+	"testing"
+	"time"
+)
+
+func TestFindingsByUser(t *testing.T) {
+	var a, b models.UUID
+	a.New()
+	b.New()
+
+	groups := findingsByUser([]models.ConsistencyFinding{
+		{Category: "live_records", UserId: a, Table: "records", RowIds: []int{1}},
+		{Category: "live_user_emails", UserId: b, Table: "user_emails", RowIds: []int{2}},
+		{Category: "live_primary_email", UserId: a, Table: "user_emails", RowIds: []int{3}},
+	})
+	if len(groups) != 2 || len(groups[0]) != 2 || len(groups[1]) != 1 {
+		t.Fatalf("Unexpected groups: %v", groups)
+	}
+	if groups[0][1].Category != "live_primary_email" || groups[1][0].UserId.String() != b.String() {
+		t.Fatalf("Groups out of order: %v", groups)
+	}
+}
+
+func TestFixableFindingsLeaveOrphansAlone(t *testing.T) {
+	var a, b models.UUID
+	a.New()
+	b.New()
+
+	// b deleted a record and its asset through the app, which looks like
+	// rows orphaned by a failed cascade
+	findings := []models.ConsistencyFinding{
+		{Category: "live_records", UserId: a, Table: "records", RowIds: []int{1}, DeletedAt: time.Now()},
+		{Category: models.InconsistentOrphanDeleted + "records", UserId: b, Table: "records", RowIds: []int{2}},
+		{Category: models.InconsistentOrphanDeleted + "user_assets", UserId: b, Table: "user_assets", RowIds: []int{3}},
+	}
+
+	fixable := fixableFindings(findings, false)
+	if len(fixable) != 1 || fixable[0].UserId.String() != a.String() {
+		t.Fatalf("Expected only the partial deletion fixed without --fix-orphans, got %v", fixable)
+	}
+	if groups := findingsByUser(fixable); len(groups) != 1 {
+		t.Fatalf("Expected user %v left alone, got %v", b, groups)
+	}
+
+	if fixable = fixableFindings(findings, true); len(fixable) != 3 {
+		t.Fatalf("Expected every finding fixed with --fix-orphans, got %v", fixable)
+	}
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"github.com/codegangsta/cli"
+	"github.com/dabfleming/gorm"
+	"log"
+	"soft_delete/driver/database"
+	"soft_delete/models"
+)
+
+var offboardCoachCommand = cli.Command{
+	Name:  "offboard-coach",
+	Usage: "Reassign a departing coach's participants, then soft delete the coach",
+	Flags: []cli.Flag{
+		cli.StringFlag{Name: "coach", Usage: "UUID of the departing coach"},
+		cli.StringFlag{Name: "to", Usage: "UUID of the coach taking over every participant"},
+		cli.StringSliceFlag{Name: "pool", Value: &cli.StringSlice{}, Usage: "UUID of a coach to spread participants across by caseload (repeatable)"},
+	},
+	Action: offboardCoachAction,
+}
+
+// A candidate coach and the number of participants they currently hold.
+type coachLoad struct {
+	coach models.Coach
+	load  int
+}
+
+func offboardCoachAction(c *cli.Context) {
+	err := offboardCoach(c.String("coach"), c.String("to"), c.StringSlice("pool"))
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+func offboardCoach(coachId, toId string, poolIds []string) (err error) {
+	if coachId == "" {
+		return errors.New("Error: --coach is required")
+	}
+	if (toId == "") == (len(poolIds) == 0) {
+		return errors.New("Error: give exactly one of --to or --pool")
+	}
+	if toId != "" {
+		poolIds = []string{toId}
+	}
+
+	// Begin TXs
+	app := database.App.Begin()
+	if app.Error != nil {
+		return app.Error
+	}
+
+	var coach models.Coach
+	err = app.Where("user_id = ?", coachId).First(&coach.User).Error
+	if err != nil {
+		app.Rollback()
+		return fmt.Errorf("No User data for coach %v: %v", coachId, err)
+	}
+
+	pool, err := loadCoachPool(app, coach, poolIds)
+	if err != nil {
+		app.Rollback()
+		return err
+	}
+
+	assocs, err := coach.ParticipantAssociationsWithTx(app)
+	if err != nil {
+		app.Rollback()
+		return fmt.Errorf("Error listing participants of coach %v: %v", coachId, err)
+	}
+
+	for i := range assocs {
+		assoc := &assocs[i]
+		target := leastLoaded(pool)
+
+		var participant models.User
+		participant.UserId.Parse(fmt.Sprintf("%v", assoc.Users["participant"]))
+
+		assoc.Users["coach"] = target.coach.UserId.String()
+		err = app.Save(assoc).Error
+		if err != nil {
+			app.Rollback()
+			return fmt.Errorf("Error reassigning participant %v: %v", participant.UserId, err)
+		}
+
+		meta := invocation.Metadata()
+		meta["previous_coach"] = coach.UserId.String()
+		meta["coach"] = target.coach.UserId.String()
+		err = participant.AddLogWithTx("offboarding.coach_reassigned", "Coach offboarded, participant reassigned", meta, app)
+		if err != nil {
+			app.Rollback()
+			return fmt.Errorf("Error logging reassignment of participant %v: %v", participant.UserId, err)
+		}
+		target.load++
+
+		log.Print("Reassigned participant ", participant.UserId, " from ", coach.UserId, " to ", target.coach.UserId)
+	}
+
+	counts, err := coach.SoftDeleteWithTx(nil, app)
+	if err != nil {
+		app.Rollback()
+		return fmt.Errorf("%v for coach %v", err, coachId)
+	}
+
+	err = audit(app, models.AuditActionQuit, "offboard-coach", "", coach.UserId, counts)
+	if err != nil {
+		app.Rollback()
+		return err
+	}
+
+	err = app.Commit().Error
+	if err != nil {
+		app.Rollback()
+		return err
+	}
+
+	log.Print("Successfully offboarded coach: ", coach.UserId, " - ", coach.DisplayName, ", reassigned ", len(assocs), " participant(s)")
+	return nil
+}
+
+// Load each coach in poolIds with their current caseload.
+func loadCoachPool(app *gorm.DB, departing models.Coach, poolIds []string) ([]*coachLoad, error) {
+	pool := make([]*coachLoad, 0, len(poolIds))
+	for _, id := range poolIds {
+		var target models.Coach
+		err := app.Where("user_id = ?", id).First(&target.User).Error
+		if err != nil {
+			return nil, fmt.Errorf("No User data for coach %v: %v", id, err)
+		}
+		if target.UserId.String() == departing.UserId.String() {
+			return nil, fmt.Errorf("Coach %v can't take over their own participants", id)
+		}
+		if !target.IsCoach() {
+			return nil, fmt.Errorf("User %v is not a coach", id)
+		}
+
+		load, err := target.CaseloadWithTx(app)
+		if err != nil {
+			return nil, fmt.Errorf("Error counting caseload of coach %v: %v", id, err)
+		}
+		pool = append(pool, &coachLoad{coach: target, load: load})
+	}
+	return pool, nil
+}
+
+// Returns the coach with the fewest participants, first listed wins ties.
+func leastLoaded(pool []*coachLoad) *coachLoad {
+	min := pool[0]
+	for _, c := range pool[1:] {
+		if c.load < min.load {
+			min = c
+		}
+	}
+	return min
+}
@@ -4,6 +4,8 @@ import (
 	"encoding/json"
 	"log"
 	"os"
+	"strings"
+	"time"
 )
 
 type Configuration struct {
@@ -14,12 +16,122 @@ type Configuration struct {
 	Debug bool `json:"debug_mode"`
 	//Database    map[string]interface{} `json:"database_int"`
 	AppDatabase map[string]interface{} `json:"database_app"`
+
+	// Days a quit stays restorable before it is finalized, and days a
+	// finalized deletion is kept before purge hard deletes it
+	GracePeriodDays int `json:"grace_period_days"`
+	RetentionDays   int `json:"retention_days"`
+
+	// Operators allowed to restore a deletion from the command line once
+	// its grace period has ended
+	RestoreAdmins []string `json:"restore_admins"`
+
+	// JSON pointers into User, UserAddress and Record Meta holding PII,
+	// e.g. "/first_name" or "/avatar"
+	ErasurePointers []string `json:"erasure_pointers"`
+
+	Research ResearchConfiguration `json:"research"`
+
+	// Reasons a quit list may give for someone leaving, by code, e.g.
+	// "terminated", "voluntary", "deceased" or "transferred"
+	ReasonCodes map[string]ReasonCode `json:"reason_codes"`
+
+	Consent ConsentConfiguration `json:"consent"`
+
+	Outbox OutboxConfiguration `json:"outbox"`
+
+	// Employers pushing quit events to the HR webhook, by employer key
+	HREmployers map[string]HREmployer `json:"hr_employers"`
+
+	// External providers participants are deprovisioned from once deleted
+	Providers []ProviderConfiguration `json:"providers"`
+
+	Jobs JobsConfiguration `json:"jobs"`
+
+	Notifications NotificationConfiguration `json:"notifications"`
+}
+
+// Emails to departing participants and a per-run summary to each employer
+// contact. Templates are file paths, the built-in ones are used if empty.
+type NotificationConfiguration struct {
+	Enabled             bool              `json:"enabled"`
+	SMTP                SMTPConfiguration `json:"smtp"`
+	ParticipantTemplate string            `json:"participant_template"`
+	EmployerTemplate    string            `json:"employer_template"`
+
+	// Employer display name to the address their summary is sent to
+	EmployerContacts map[string]string `json:"employer_contacts"`
+}
+
+type SMTPConfiguration struct {
+	Host     string `json:"host"`
+	Port     int    `json:"port"`
+	Username string `json:"username"`
+	Password string `json:"password"`
+	From     string `json:"from"`
+}
+
+// How many attempts a queued side effect gets before it is dead-lettered
+type JobsConfiguration struct {
+	MaxAttempts int `json:"max_attempts"`
+}
+
+// One external provider; Type selects the client, e.g. "validic"
+type ProviderConfiguration struct {
+	Name           string `json:"name"`
+	Type           string `json:"type"`
+	URL            string `json:"url"`
+	OrganizationId string `json:"organization_id"`
+	Token          string `json:"token"`
+}
+
+// Company is the employer's display name; Secret signs their events
+type HREmployer struct {
+	Company string `json:"company"`
+	Secret  string `json:"secret"`
+}
+
+// Where the dispatcher delivers outbox events, and how many attempts an
+// event gets before it is given up on
+type OutboxConfiguration struct {
+	Sinks       []SinkConfiguration `json:"sinks"`
+	MaxAttempts int                 `json:"max_attempts"`
+}
+
+// A "webhook" POSTing each event to URL, or a "file" appending each event
+// to Path as a JSON line
+type SinkConfiguration struct {
+	Type string `json:"type"`
+	URL  string `json:"url"`
+	Path string `json:"path"`
+}
+
+// What revoking genetic consent erases: records of these entities, and
+// these JSON pointers into User and Record Meta
+type ConsentConfiguration struct {
+	GeneticEntities []string `json:"genetic_entities"`
+	GeneticPointers []string `json:"genetic_pointers"`
+}
+
+// How a quit with this reason is handled
+type ReasonCode struct {
+	Description          string `json:"description"`
+	SuppressNotification bool   `json:"suppress_notification"`
+}
+
+// Which records of quitting participants are kept, de-identified, for
+// research, and where the encrypted subject mapping is written
+type ResearchConfiguration struct {
+	Entities      []string `json:"entities"`
+	MetaAllowlist []string `json:"meta_allowlist"`
+	KeyFile       string   `json:"key_file"`
 }
 
 var config *Configuration = nil
+var config_location string
 
 func init() {
-	config_location := os.Getenv("INTAKE_CONFIG")
+	config_location = os.Getenv("INTAKE_CONFIG")
 	if config_location == "" {
 		config_location = ".newtopia.json"
 	}
@@ -45,6 +157,53 @@ func GetConfiguration() *Configuration {
 	return config
 }
 
+// Looks up a configured reason code, ignoring case.
+func Reason(code string) (ReasonCode, bool) {
+	reason, ok := config.ReasonCodes[strings.ToLower(code)]
+	return reason, ok
+}
+
+// Whether operator may restore finalized deletions from the command line.
+func IsRestoreAdmin(operator string) bool {
+	if operator == "" {
+		return false
+	}
+	for _, admin := range config.RestoreAdmins {
+		if admin == operator {
+			return true
+		}
+	}
+	return false
+}
+
+// Path the configuration was loaded from
+func Location() string {
+	return config_location
+}
+
 func IsDebug() bool {
 	return config.Debug
 }
+
+// Periods used when grace_period_days or retention_days is missing, or not
+// positive, so an unset period can't have finalize erase or purge hard
+// delete a quit straight away
+const (
+	DefaultGracePeriodDays = 30
+	DefaultRetentionDays   = 90
+)
+
+func GracePeriod() time.Duration {
+	return days(config.GracePeriodDays, DefaultGracePeriodDays)
+}
+
+func RetentionPeriod() time.Duration {
+	return days(config.RetentionDays, DefaultRetentionDays)
+}
+
+func days(configured, fallback int) time.Duration {
+	if configured <= 0 {
+		configured = fallback
+	}
+	return time.Duration(configured) * 24 * time.Hour
+}
@@ -2,6 +2,7 @@ package configuration
 
 import (
 	"testing"
+	"time"
 )
 
 func TestConfiguration(t *testing.T) {
@@ -17,3 +18,23 @@ func TestIsDebug(t *testing.T) {
 		t.Fatal("Can't check IsDebug()")
 	}
 }
+
+func TestPeriodsUnset(t *testing.T) {
+	saved := config
+	defer func() { config = saved }()
+
+	config = &Configuration{}
+	if GracePeriod() != DefaultGracePeriodDays*24*time.Hour || RetentionPeriod() != DefaultRetentionDays*24*time.Hour {
+		t.Fatalf("Expected default grace and retention periods when unset, got %v and %v", GracePeriod(), RetentionPeriod())
+	}
+
+	config = &Configuration{GracePeriodDays: -1, RetentionDays: 0}
+	if GracePeriod() != DefaultGracePeriodDays*24*time.Hour || RetentionPeriod() != DefaultRetentionDays*24*time.Hour {
+		t.Fatalf("Expected default grace and retention periods when not positive, got %v and %v", GracePeriod(), RetentionPeriod())
+	}
+
+	config = &Configuration{GracePeriodDays: 7, RetentionDays: 14}
+	if GracePeriod() != 7*24*time.Hour || RetentionPeriod() != 14*24*time.Hour {
+		t.Fatalf("Expected configured grace and retention periods, got %v and %v", GracePeriod(), RetentionPeriod())
+	}
+}
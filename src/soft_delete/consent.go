@@ -0,0 +1,366 @@
+package main
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"github.com/codegangsta/cli"
+	"github.com/dabfleming/gorm"
+	"io"
+	"log"
+	"os"
+	"soft_delete/configuration"
+	"soft_delete/driver/database"
+	"soft_delete/models"
+	"strings"
+	"time"
+)
+
+var consentCommand = cli.Command{
+	Name:  "consent",
+	Usage: "Process consent revocations",
+	Subcommands: []cli.Command{
+		{
+			Name:  "revoke",
+			Usage: "Revoke a consent for every user in a CSV; CSA offboards them, genetic erases their genetics data",
+			Flags: []cli.Flag{
+				cli.StringFlag{Name: "type", Usage: "consent revoked, csa or genetic"},
+				cli.StringFlag{Name: "file", Usage: "revocations (user[, revoked_at, source]), user being a UUID or email"},
+				cli.BoolFlag{Name: "dry-run", Usage: "match every row and report, but change nothing"},
+				cli.StringFlag{Name: "report", Usage: "write the per-row report to this CSV file"},
+			},
+			Action: consentRevokeAction,
+		},
+		{
+			Name:  "import",
+			Usage: "Record the consents given in a CSV, e.g. exported from registration",
+			Flags: []cli.Flag{
+				cli.StringFlag{Name: "file", Usage: "consents (user, type, version[, given_at, source]), user being a UUID or email"},
+				cli.BoolFlag{Name: "dry-run", Usage: "match every row and report, but change nothing"},
+				cli.StringFlag{Name: "report", Usage: "write the per-row report to this CSV file"},
+			},
+			Action: consentImportAction,
+		},
+	},
+}
+
+// One row of a consent file
+type givenConsent struct {
+	Row     int
+	User    string
+	Type    string
+	Version string
+	GivenAt time.Time
+	Source  string
+}
+
+// One row of a revocation file
+type revocation struct {
+	Row       int
+	User      string
+	RevokedAt time.Time
+	Source    string
+}
+
+func consentRevokeAction(c *cli.Context) {
+	run, err := revokeConsents(c.String("type"), c.String("file"), runOptions(c))
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	err = run.Finish(c.String("report"))
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+func revokeConsents(consentType, filename string, opts RunOptions) (*Run, error) {
+	if !models.IsConsentType(consentType) {
+		return nil, fmt.Errorf("Error: --type must be %v or %v", models.ConsentCSA, models.ConsentGenetic)
+	}
+	if filename == "" {
+		return nil, errors.New("Error: --file is required")
+	}
+
+	revocations, invalid, err := readRevocations(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	var run *Run
+	if consentType == models.ConsentCSA {
+		run, err = NewRun(filename, opts)
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		// Nobody is deleted, so there is no batch to record
+		if !opts.DryRun {
+			err = invocation.Check()
+			if err != nil {
+				return nil, err
+			}
+		}
+		run = &Run{RunOptions: opts, Batch: &models.DeletionBatch{Source: filename}, Report: NewRunReport(filename, opts.DryRun)}
+	}
+	run.InputHash, err = fileHash(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, result := range invalid {
+		run.Report.Add(result)
+	}
+	for _, rev := range revocations {
+		run.Report.Add(run.revokeConsent(consentType, rev))
+	}
+	return run, nil
+}
+
+// Record the revocation, then offboard the user or erase their genetics.
+// The revocation is committed on its own so it stands even if a legal
+// hold blocks what follows.
+func (run *Run) revokeConsent(consentType string, rev revocation) RowResult {
+	result := RowResult{Row: rev.Row}
+
+	user, err := findUser(database.App, rev.User)
+	if err != nil {
+		return result.with(OutcomeNoEmail, "No User data for ", rev.User, " ~ Err: ", err)
+	}
+	result.UserId = user.UserId.String()
+
+	if !run.DryRun {
+		err = inTransaction(func(app *gorm.DB) error {
+			return user.RevokeConsentWithTx(consentType, rev.Source, rev.RevokedAt, app)
+		})
+		if err != nil {
+			return result.with(OutcomeError, "Error revoking ", consentType, " consent of ", user.UserId, " ~ Err: ", err)
+		}
+	}
+
+	// Begin TXs
+	app := database.App.Begin()
+	if app.Error != nil {
+		log.Fatalf("Error starting transaction(s).\n\tApp: %v\n", app.Error)
+	}
+
+	if consentType == models.ConsentCSA {
+		outcome, err := run.commitDeletion(app, user, models.Metadata{"row": rev.Row, "consent_revoked": consentType})
+		if err != nil {
+			return result.with(outcome, err, " offboarding ", user.UserId, " on revoked ", consentType, " consent")
+		}
+		return result.with(outcome, "Consent ", consentType, " revoked, offboarded: ", user.UserId)
+	}
+
+	conf := configuration.GetConfiguration().Consent
+	erased, err := user.EraseGeneticsWithTx(conf.GeneticEntities, conf.GeneticPointers, app)
+	if err != nil {
+		app.Rollback()
+		return result.with(outcomeFor(err), err, " erasing genetics of ", user.UserId)
+	}
+
+	if run.DryRun {
+		app.Rollback()
+		return result.with(OutcomePreview, "Would erase genetics of ", user.UserId, ": ", erased.Counts())
+	}
+
+	err = audit(app, models.AuditActionGenetics, run.Batch.Source, run.InputHash, user.UserId, erased.Counts())
+	if err != nil {
+		app.Rollback()
+		return result.with(OutcomeError, err, " erasing genetics of ", user.UserId)
+	}
+
+	err = app.Commit().Error
+	if err != nil {
+		app.Rollback()
+		return result.with(OutcomeError, err, " erasing genetics of ", user.UserId)
+	}
+	return result.with(OutcomeErased, "Consent ", consentType, " revoked, erased genetics of ", user.UserId, ": ", erased.Counts())
+}
+
+// Reads a revocation file. Rows that can't be parsed are returned as
+// invalid report rows. revoked_at defaults to now and source to the file.
+func readRevocations(filename string) ([]revocation, []RowResult, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer file.Close()
+
+	r := csv.NewReader(file)
+	r.FieldsPerRecord = -1
+
+	var columns map[string]int
+	revocations := make([]revocation, 0)
+	invalid := make([]RowResult, 0)
+	for i := 0; ; i++ {
+		row, err := r.Read()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, nil, err
+		}
+
+		//Header row names the optional columns
+		if i == 0 {
+			columns = headerColumns(row)
+			continue
+		}
+
+		rev := revocation{
+			Row:       i,
+			RevokedAt: time.Now(),
+			Source:    optionalColumn(row, columns, "source"),
+		}
+		if len(row) > 0 {
+			rev.User = strings.TrimSpace(row[0])
+		}
+		if rev.User == "" {
+			invalid = append(invalid, RowResult{Row: i}.with(OutcomeInvalid, "Row ", i, " names no user"))
+			continue
+		}
+		if rev.Source == "" {
+			rev.Source = filename
+		}
+		if date := optionalColumn(row, columns, "revoked_at"); date != "" {
+			rev.RevokedAt, err = time.ParseInLocation(effectiveDateFormat, date, time.Local)
+			if err != nil {
+				invalid = append(invalid, RowResult{Row: i}.with(OutcomeInvalid, "Invalid revoked_at for ", rev.User, ": ", date, " ~ Err: ", err))
+				continue
+			}
+		}
+		revocations = append(revocations, rev)
+	}
+	return revocations, invalid, nil
+}
+
+func consentImportAction(c *cli.Context) {
+	run, err := importConsents(c.String("file"), runOptions(c))
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	err = run.Finish(c.String("report"))
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+func importConsents(filename string, opts RunOptions) (*Run, error) {
+	if filename == "" {
+		return nil, errors.New("Error: --file is required")
+	}
+	if !opts.DryRun {
+		err := invocation.Check()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	consents, invalid, err := readConsents(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	// Nobody is deleted, so there is no batch to record
+	run := &Run{RunOptions: opts, Batch: &models.DeletionBatch{Source: filename}, Report: NewRunReport(filename, opts.DryRun)}
+	run.InputHash, err = fileHash(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, result := range invalid {
+		run.Report.Add(result)
+	}
+	for _, consent := range consents {
+		run.Report.Add(run.giveConsent(consent))
+	}
+	return run, nil
+}
+
+func (run *Run) giveConsent(consent givenConsent) RowResult {
+	result := RowResult{Row: consent.Row}
+
+	user, err := findUser(database.App, consent.User)
+	if err != nil {
+		return result.with(OutcomeNoEmail, "No User data for ", consent.User, " ~ Err: ", err)
+	}
+	result.UserId = user.UserId.String()
+
+	if run.DryRun {
+		return result.with(OutcomePreview, "Would record ", consent.Type, " consent ", consent.Version, " of ", user.UserId)
+	}
+
+	err = inTransaction(func(app *gorm.DB) error {
+		_, err := user.GiveConsentWithTx(consent.Type, consent.Version, consent.Source, consent.GivenAt, app)
+		return err
+	})
+	if err != nil {
+		return result.with(OutcomeError, "Error recording ", consent.Type, " consent of ", user.UserId, " ~ Err: ", err)
+	}
+	return result.with(OutcomeRecorded, "Recorded ", consent.Type, " consent ", consent.Version, " of ", user.UserId)
+}
+
+// Reads a consent file. Rows that can't be parsed are returned as invalid
+// report rows. given_at defaults to now and source to the file.
+func readConsents(filename string) ([]givenConsent, []RowResult, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer file.Close()
+
+	r := csv.NewReader(file)
+	r.FieldsPerRecord = -1
+
+	var columns map[string]int
+	consents := make([]givenConsent, 0)
+	invalid := make([]RowResult, 0)
+	for i := 0; ; i++ {
+		row, err := r.Read()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, nil, err
+		}
+
+		//Header row names the optional columns
+		if i == 0 {
+			columns = headerColumns(row)
+			continue
+		}
+
+		if len(row) < 3 {
+			invalid = append(invalid, RowResult{Row: i}.with(OutcomeInvalid, "Row ", i, " has ", len(row), " column(s), expected at least 3"))
+			continue
+		}
+		consent := givenConsent{
+			Row:     i,
+			User:    strings.TrimSpace(row[0]),
+			Type:    strings.ToLower(strings.TrimSpace(row[1])),
+			Version: strings.TrimSpace(row[2]),
+			GivenAt: time.Now(),
+			Source:  optionalColumn(row, columns, "source"),
+		}
+		if consent.User == "" || consent.Version == "" {
+			invalid = append(invalid, RowResult{Row: i}.with(OutcomeInvalid, "Row ", i, " names no user or version"))
+			continue
+		}
+		if !models.IsConsentType(consent.Type) {
+			invalid = append(invalid, RowResult{Row: i}.with(OutcomeInvalid, "Unknown consent type for ", consent.User, ": ", consent.Type))
+			continue
+		}
+		if consent.Source == "" {
+			consent.Source = filename
+		}
+		if date := optionalColumn(row, columns, "given_at"); date != "" {
+			consent.GivenAt, err = time.ParseInLocation(effectiveDateFormat, date, time.Local)
+			if err != nil {
+				invalid = append(invalid, RowResult{Row: i}.with(OutcomeInvalid, "Invalid given_at for ", consent.User, ": ", date, " ~ Err: ", err))
+				continue
+			}
+		}
+		consents = append(consents, consent)
+	}
+	return consents, invalid, nil
+}
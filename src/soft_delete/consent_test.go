@@ -0,0 +1,37 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestReadConsents(t *testing.T) {
+	file, err := ioutil.TempFile("", "consents")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(file.Name())
+
+	file.WriteString("user,type,version,given_at,source\n" +
+		"ada@example.com,CSA,v2,2015-06-11,registration\n" +
+		"bob@example.com,genetic,v1\n" +
+		"cy@example.com,marketing,v1\n" +
+		"dee@example.com,csa\n" +
+		"eve@example.com,csa,v1,not a date\n")
+	file.Close()
+
+	consents, invalid, err := readConsents(file.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(consents) != 2 || len(invalid) != 3 {
+		t.Fatalf("Expected 2 consents and 3 invalid rows, got %+v and %+v", consents, invalid)
+	}
+	if consents[0].Type != "csa" || consents[0].Source != "registration" || consents[0].GivenAt.Day() != 11 {
+		t.Fatalf("Unexpected first consent: %+v", consents[0])
+	}
+	if consents[1].Source != file.Name() {
+		t.Fatalf("Expected source to default to the file, got %+v", consents[1])
+	}
+}
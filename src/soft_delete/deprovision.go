@@ -0,0 +1,63 @@
+package main
+
+import (
+	"fmt"
+	"github.com/dabfleming/gorm"
+	"soft_delete/configuration"
+	"soft_delete/deprovision"
+	"soft_delete/models"
+)
+
+// Job type removing a deleted user from one external provider
+const jobDeprovision = "deprovision"
+
+func newDeprovisioners(confs []configuration.ProviderConfiguration) ([]deprovision.Deprovisioner, error) {
+	providers := make([]deprovision.Deprovisioner, 0, len(confs))
+	for _, conf := range confs {
+		provider, err := deprovision.New(deprovision.Config{
+			Name:           conf.Name,
+			Type:           conf.Type,
+			URL:            conf.URL,
+			OrganizationId: conf.OrganizationId,
+			Token:          conf.Token,
+		})
+		if err != nil {
+			return nil, err
+		}
+		providers = append(providers, provider)
+	}
+	return providers, nil
+}
+
+// Queue user's removal from each provider within app.
+func enqueueDeprovisioning(app *gorm.DB, user models.User, providers []deprovision.Deprovisioner) ([]*models.Job, error) {
+	jobs := make([]*models.Job, 0, len(providers))
+	for _, provider := range providers {
+		job, err := models.EnqueueJobWithTx(jobDeprovision, models.Metadata{
+			"user_id":  user.UserId.String(),
+			"provider": provider.Name(),
+		}, app)
+		if err != nil {
+			return nil, fmt.Errorf("Error queueing deprovisioning from %v: %v", provider.Name(), err)
+		}
+		jobs = append(jobs, job)
+	}
+	return jobs, nil
+}
+
+// Runs a deprovision job: {"user_id": ..., "provider": ...}
+func deprovisionJob(payload models.Metadata) error {
+	userId, _ := payload["user_id"].(string)
+	name, _ := payload["provider"].(string)
+
+	providers, err := newDeprovisioners(configuration.GetConfiguration().Providers)
+	if err != nil {
+		return err
+	}
+	for _, provider := range providers {
+		if provider.Name() == name {
+			return provider.Deprovision(userId)
+		}
+	}
+	return permanentJobError{fmt.Errorf("Provider %v is no longer configured", name)}
+}
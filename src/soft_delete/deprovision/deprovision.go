@@ -0,0 +1,50 @@
+// Package deprovision removes departed participants from the external
+// providers they were enrolled in, such as the Validic wearable-data
+// platform. Providers are built by type from configuration.
+package deprovision
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// Removes a user from one external provider. Deprovisioning a user the
+// provider doesn't know is not an error, so calls can be retried.
+type Deprovisioner interface {
+	Name() string
+	Deprovision(userId string) error
+}
+
+// One configured provider. Type selects the implementation, the other
+// fields are read by the types that need them.
+type Config struct {
+	Name           string
+	Type           string
+	URL            string
+	OrganizationId string
+	Token          string
+}
+
+// Builds a provider from its configuration
+type Factory func(conf Config) (Deprovisioner, error)
+
+var registry = map[string]Factory{
+	"validic": newValidic,
+}
+
+// Add a provider type. Not safe to call concurrently with New.
+func Register(providerType string, factory Factory) {
+	registry[providerType] = factory
+}
+
+func New(conf Config) (Deprovisioner, error) {
+	factory, ok := registry[conf.Type]
+	if !ok {
+		return nil, fmt.Errorf("Unknown provider type %v for %v", conf.Type, conf.Name)
+	}
+	return factory(conf)
+}
+
+// HTTP client shared by providers
+var httpClient = &http.Client{Timeout: 30 * time.Second}
@@ -0,0 +1,64 @@
+package deprovision
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Client for Validic's organization user API. Users are provisioned with
+// our user UUID as their uid.
+type Validic struct {
+	name           string
+	baseURL        string
+	organizationId string
+	token          string
+	client         *http.Client
+}
+
+func newValidic(conf Config) (Deprovisioner, error) {
+	if conf.URL == "" || conf.OrganizationId == "" || conf.Token == "" {
+		return nil, errors.New("Validic provider " + conf.Name + " needs url, organization_id and token")
+	}
+	return &Validic{
+		name:           conf.Name,
+		baseURL:        strings.TrimRight(conf.URL, "/"),
+		organizationId: conf.OrganizationId,
+		token:          conf.Token,
+		client:         httpClient,
+	}, nil
+}
+
+func (v *Validic) Name() string {
+	return v.name
+}
+
+// DELETE /organizations/{organization}/users/{uid}.json. A 404 means the
+// user was never provisioned or is already gone. The API only takes the
+// token as access_token in the query string, so the URL is kept out of
+// every error returned, and so out of logs and job errors.
+func (v *Validic) Deprovision(userId string) error {
+	endpoint := fmt.Sprintf("%v/organizations/%v/users/%v.json?access_token=%v",
+		v.baseURL, url.QueryEscape(v.organizationId), url.QueryEscape(userId), url.QueryEscape(v.token))
+
+	req, err := http.NewRequest("DELETE", endpoint, nil)
+	if err != nil {
+		return fmt.Errorf("Validic %v: invalid request URL", v.name)
+	}
+
+	resp, err := v.client.Do(req)
+	if urlErr, ok := err.(*url.Error); ok {
+		err = urlErr.Err
+	}
+	if err != nil {
+		return fmt.Errorf("Validic %v: error deprovisioning %v: %v", v.name, userId, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound || (resp.StatusCode >= 200 && resp.StatusCode <= 299) {
+		return nil
+	}
+	return fmt.Errorf("Validic %v responded %v deprovisioning %v", v.name, resp.Status, userId)
+}
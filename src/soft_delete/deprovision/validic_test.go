@@ -0,0 +1,87 @@
+package deprovision
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// A local stand-in for Validic's organization user API.
+type fakeValidic struct {
+	mu    sync.Mutex
+	users map[string]bool
+	fail  bool
+}
+
+func (f *fakeValidic) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.fail {
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	if r.Method != "DELETE" || r.URL.Query().Get("access_token") != "token" {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	uid := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/organizations/org/users/"), ".json")
+	if !f.users[uid] {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	delete(f.users, uid)
+	w.WriteHeader(http.StatusOK)
+}
+
+func TestValidicDeprovision(t *testing.T) {
+	fake := &fakeValidic{users: map[string]bool{"user-1": true}}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	provider, err := New(Config{Name: "validic", Type: "validic", URL: server.URL, OrganizationId: "org", Token: "token"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = provider.Deprovision("user-1")
+	if err != nil || fake.users["user-1"] {
+		t.Fatalf("Expected user-1 deprovisioned (err: %v)", err)
+	}
+
+	// Already gone
+	err = provider.Deprovision("user-1")
+	if err != nil {
+		t.Fatal("Expected deprovisioning an unknown user to succeed: ", err)
+	}
+
+	fake.fail = true
+	if provider.Deprovision("user-2") == nil {
+		t.Fatal("Expected a server error to fail deprovisioning")
+	}
+}
+
+func TestValidicErrorHidesToken(t *testing.T) {
+	server := httptest.NewServer(&fakeValidic{})
+	provider, err := New(Config{Name: "validic", Type: "validic", URL: server.URL, OrganizationId: "org", Token: "s3cret-token"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Nothing listening any more, so the request itself fails
+	server.Close()
+
+	err = provider.Deprovision("user-1")
+	if err == nil || strings.Contains(err.Error(), "s3cret-token") {
+		t.Fatalf("Expected an error without the token, got %v", err)
+	}
+}
+
+func TestUnknownProviderType(t *testing.T) {
+	_, err := New(Config{Name: "x", Type: "nope"})
+	if err == nil {
+		t.Fatal("Expected an unknown provider type to be refused")
+	}
+}
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/codegangsta/cli"
+	"log"
+	"net/http"
+	"os"
+	"soft_delete/configuration"
+	"soft_delete/driver/database"
+	"soft_delete/models"
+	"time"
+)
+
+var dispatchCommand = cli.Command{
+	Name:  "dispatch",
+	Usage: "Deliver outbox events (UserSoftDeleted, UserRestored, RecordDeleted) to the configured sinks",
+	Flags: []cli.Flag{
+		cli.BoolFlag{Name: "follow", Usage: "keep polling for new events instead of exiting once the outbox is drained"},
+		cli.DurationFlag{Name: "interval", Value: 10 * time.Second, Usage: "how often to poll when following"},
+	},
+	Action: dispatchAction,
+}
+
+// Attempts an event gets when max_attempts isn't configured
+const defaultMaxAttempts = 10
+
+// Events loaded per poll
+const dispatchBatchSize = 100
+
+// Somewhere outbox events are delivered to. Events may be delivered more
+// than once, so sinks should dedupe on the event id.
+type EventSink interface {
+	Deliver(event outboxMessage) error
+}
+
+// An event as delivered to sinks
+type outboxMessage struct {
+	Id        int             `json:"id"`
+	Type      string          `json:"type"`
+	UserId    string          `json:"user_id"`
+	Payload   models.Metadata `json:"payload"`
+	CreatedAt time.Time       `json:"created_at"`
+}
+
+func newOutboxMessage(event models.OutboxEvent) outboxMessage {
+	return outboxMessage{
+		Id:        event.ID,
+		Type:      event.Type,
+		UserId:    event.UserId.String(),
+		Payload:   event.Payload,
+		CreatedAt: event.CreatedAt,
+	}
+}
+
+// POSTs each event as JSON, any 2xx status counting as delivered.
+type webhookSink struct {
+	url    string
+	client *http.Client
+}
+
+func (s *webhookSink) Deliver(event outboxMessage) error {
+	body, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	resp, err := s.client.Post(s.url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("Webhook %v responded %v", s.url, resp.Status)
+	}
+	return nil
+}
+
+// Appends each event to a file as a line of JSON.
+type fileSink struct {
+	path string
+}
+
+func (s *fileSink) Deliver(event outboxMessage) error {
+	line, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(s.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	_, err = file.Write(append(line, '\n'))
+	return err
+}
+
+func newEventSinks(confs []configuration.SinkConfiguration) ([]EventSink, error) {
+	sinks := make([]EventSink, 0, len(confs))
+	for _, conf := range confs {
+		switch conf.Type {
+		case "webhook":
+			sinks = append(sinks, &webhookSink{url: conf.URL, client: &http.Client{Timeout: 30 * time.Second}})
+		case "file":
+			sinks = append(sinks, &fileSink{path: conf.Path})
+		default:
+			return nil, fmt.Errorf("Error: unknown outbox sink type %v", conf.Type)
+		}
+	}
+	return sinks, nil
+}
+
+func dispatchAction(c *cli.Context) {
+	conf := configuration.GetConfiguration().Outbox
+	sinks, err := newEventSinks(conf.Sinks)
+	if err != nil {
+		log.Fatal(err)
+	}
+	if len(sinks) == 0 {
+		log.Fatal("Error: no outbox sinks configured")
+	}
+
+	maxAttempts := conf.MaxAttempts
+	if maxAttempts <= 0 {
+		maxAttempts = defaultMaxAttempts
+	}
+
+	for {
+		attempted, err := dispatchDue(sinks, maxAttempts)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if attempted > 0 {
+			continue
+		}
+		if !c.Bool("follow") {
+			return
+		}
+		time.Sleep(c.Duration("interval"))
+	}
+}
+
+// Attempt every due event once. Returns the number of events attempted.
+func dispatchDue(sinks []EventSink, maxAttempts int) (int, error) {
+	due, err := models.DueEventsWithTx(time.Now(), dispatchBatchSize, database.App)
+	if err != nil {
+		return 0, fmt.Errorf("Error reading outbox: %v", err)
+	}
+
+	for i := range due {
+		event := &due[i]
+		cause := deliverEvent(sinks, newOutboxMessage(*event))
+		if cause == nil {
+			err = event.MarkDeliveredWithTx(database.App)
+		} else {
+			var retryAt time.Time
+			if event.Attempts+1 < maxAttempts {
+				retryAt = time.Now().Add(retryBackoff(event.Attempts))
+			}
+			log.Print("Error delivering event ", event.ID, " (attempt ", event.Attempts+1, ") ~ Err: ", cause)
+			err = event.MarkFailedWithTx(cause, retryAt, database.App)
+		}
+		if err != nil {
+			return i, fmt.Errorf("Error updating outbox event %v: %v", event.ID, err)
+		}
+	}
+	return len(due), nil
+}
+
+// Deliver to every sink. A failure at any sink fails the event, and on
+// retry it goes to every sink again.
+func deliverEvent(sinks []EventSink, event outboxMessage) error {
+	for _, sink := range sinks {
+		err := sink.Deliver(event)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Wait before the next attempt: 30s doubling per attempt, capped at 6h.
+func retryBackoff(attempts int) time.Duration {
+	const max = 6 * time.Hour
+	wait := 30 * time.Second
+	for i := 0; i < attempts; i++ {
+		wait *= 2
+		if wait >= max {
+			return max
+		}
+	}
+	return wait
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestEventSinks(t *testing.T) {
+	var received outboxMessage
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewDecoder(r.Body).Decode(&received)
+	}))
+	defer server.Close()
+
+	dir, err := ioutil.TempDir("", "dispatch_test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "events.jsonl")
+
+	sinks := []EventSink{
+		&webhookSink{url: server.URL, client: http.DefaultClient},
+		&fileSink{path: path},
+	}
+
+	event := outboxMessage{Id: 7, Type: "UserSoftDeleted", UserId: "u-1"}
+	err = deliverEvent(sinks, event)
+	if err != nil {
+		t.Fatal("Couldn't deliver event: ", err)
+	}
+	if received.Id != 7 || received.Type != "UserSoftDeleted" {
+		t.Fatalf("Webhook received %#v", received)
+	}
+
+	written, err := ioutil.ReadFile(path)
+	if err != nil || !strings.Contains(string(written), `"id":7`) {
+		t.Fatalf("File sink wrote %q (err: %v)", written, err)
+	}
+}
+
+func TestWebhookSinkFailure(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	sink := &webhookSink{url: server.URL, client: http.DefaultClient}
+	if sink.Deliver(outboxMessage{Id: 1}) == nil {
+		t.Fatal("Expected a 503 to fail delivery")
+	}
+}
+
+func TestRetryBackoff(t *testing.T) {
+	if retryBackoff(0) != 30*time.Second || retryBackoff(1) != time.Minute {
+		t.Fatalf("Unexpected backoff: %v, %v", retryBackoff(0), retryBackoff(1))
+	}
+	if retryBackoff(100) != 6*time.Hour {
+		t.Fatalf("Backoff not capped: %v", retryBackoff(100))
+	}
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"github.com/codegangsta/cli"
+	"github.com/dabfleming/gorm"
+	"log"
+	"soft_delete/driver/database"
+	"soft_delete/models"
+)
+
+var offboardEmployerCommand = cli.Command{
+	Name:  "offboard-employer",
+	Usage: "Soft delete every participant of an employer whose contract has ended",
+	Flags: []cli.Flag{
+		cli.StringFlag{Name: "employer", Usage: "UUID or display name of the employer user"},
+		cli.BoolFlag{Name: "delete-employer", Usage: "also soft delete the employer user once every participant is deleted"},
+		cli.BoolFlag{Name: "dry-run", Usage: "list the participants that would be deleted, but delete nothing"},
+		cli.StringFlag{Name: "report", Usage: "write the per-row report to this CSV file"},
+		cli.BoolFlag{Name: "retain-research", Usage: "keep configured health records under a pseudonymous subject instead of deleting them"},
+	},
+	Action: offboardEmployerAction,
+}
+
+func offboardEmployerAction(c *cli.Context) {
+	run, err := offboardEmployer(c.String("employer"), c.Bool("delete-employer"), runOptions(c))
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	err = run.Finish(c.String("report"))
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+func offboardEmployer(idOrName string, deleteEmployer bool, opts RunOptions) (*Run, error) {
+	if idOrName == "" {
+		return nil, errors.New("Error: --employer is required")
+	}
+
+	employer, err := findEmployer(database.App, idOrName)
+	if err != nil {
+		return nil, fmt.Errorf("No User data for this Company: %v ~ Err: %v", idOrName, err)
+	}
+
+	participants, err := employerParticipants(database.App, employer)
+	if err != nil {
+		return nil, fmt.Errorf("Error listing participants of %v: %v", employer.DisplayName, err)
+	}
+
+	run, err := NewRun(employer.DisplayName, opts)
+	if err != nil {
+		return nil, err
+	}
+	report := run.Report
+
+	for i, userId := range participants {
+		report.Add(run.offboardEmployerParticipant(employer, userId, i+1))
+	}
+
+	if !deleteEmployer {
+		return run, nil
+	}
+
+	result := RowResult{
+		Row:      len(participants) + 1,
+		UserId:   employer.UserId.String(),
+		Company:  employer.DisplayName,
+		Employer: employer.DisplayName,
+	}
+	for _, row := range report.Rows {
+		if row.Outcome != OutcomeDeleted && row.Outcome != OutcomePreview {
+			report.Add(result.with(OutcomeError, "Not deleting employer ", employer.DisplayName, ", participant ", row.UserId, " was not deleted"))
+			return run, nil
+		}
+	}
+
+	app := database.App.Begin()
+	if app.Error != nil {
+		return run, app.Error
+	}
+	outcome, err := run.commitDeletion(app, employer, models.Metadata{"employer": employer.DisplayName})
+	if err != nil {
+		report.Add(result.with(outcome, err, " for Company: ", employer.DisplayName))
+	} else {
+		report.Add(result.with(outcome, "Employer ", outcome, ": ", employer.UserId, " - ", employer.DisplayName))
+	}
+
+	return run, nil
+}
+
+// Soft delete a single participant found through an employer association.
+func (run *Run) offboardEmployerParticipant(employer models.User, userId models.UUID, row int) RowResult {
+	result := RowResult{
+		Row:      row,
+		UserId:   userId.String(),
+		Company:  employer.DisplayName,
+		Employer: employer.DisplayName,
+	}
+
+	// Begin TXs
+	app := database.App.Begin()
+	if app.Error != nil {
+		log.Fatalf("Error starting transaction(s).\n\tApp: %v\n", app.Error)
+	}
+
+	// Names and email are for the report only, missing ones don't block deletion
+	result.FirstName, result.LastName, _ = intakeNames(app, userId)
+	var userEmail models.UserEmail
+	if app.Where("user_id = ?", userId).First(&userEmail).Error == nil {
+		result.Email = userEmail.Email
+	}
+
+	participant := models.User{UserId: userId}
+	outcome, err := run.commitDeletion(app, participant, models.Metadata{"row": row, "employer": employer.DisplayName})
+	if err != nil {
+		return result.with(outcome, err, " for Person: ", userId, " and this Company: ", employer.DisplayName)
+	}
+	if outcome == OutcomePreview {
+		return result.with(outcome, "Would Soft-Delete: ", userId, " - ", result.FirstName, " ", result.LastName, ", ", result.Email)
+	}
+	return result.with(outcome, "Successfully Soft-Deleted: ", userId, " - ", result.FirstName, " ", result.LastName, ", ", result.Email)
+}
+
+// Looks up an employer user by UUID, or by display name if idOrName isn't one.
+func findEmployer(db *gorm.DB, idOrName string) (models.User, error) {
+	var employer models.User
+	var id models.UUID
+
+	id.Parse(idOrName)
+	if id.UUID != nil {
+		err := db.Where("user_id = ?", id).First(&employer).Error
+		return employer, err
+	}
+
+	err := db.Where("display_name = ?", idOrName).First(&employer).Error
+	return employer, err
+}
+
+// Returns the UUIDs of every participant with a participant:employer
+// association to employer.
+func employerParticipants(db *gorm.DB, employer models.User) ([]models.UUID, error) {
+	var assocs []models.Association
+	err := db.Where("type = 'participant:employer' and (users #>> '{employer}')::uuid = ?", employer.UserId).Find(&assocs).Error
+	if err != nil && err != gorm.RecordNotFound {
+		return nil, err
+	}
+
+	participants := make([]models.UUID, 0, len(assocs))
+	for _, assoc := range assocs {
+		var userId models.UUID
+		userId.Parse(fmt.Sprintf("%v", assoc.Users["participant"]))
+		participants = append(participants, userId)
+	}
+	return participants, nil
+}
@@ -0,0 +1,186 @@
+package main
+
+import (
+	"fmt"
+	htmltemplate "html/template"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Name of the report holding rows whose company didn't resolve
+const unresolvedReport = "unresolved"
+
+// The rows of a run submitted for one employer, to confirm back to them
+// what was done with their list.
+type employerReport struct {
+	Employer  string
+	Source    string
+	DryRun    bool
+	Generated time.Time
+	Rows      []RowResult
+	Totals    []outcomeTotal
+}
+
+type outcomeTotal struct {
+	Outcome string
+	Count   int
+}
+
+// Split the report's rows by the employer they resolved to. Rows that
+// stopped before an employer was resolved, whatever company they gave, go
+// to the unresolved report instead. Employers are sorted by name.
+func employerReports(r *RunReport) (reports []employerReport, unresolved employerReport) {
+	unresolved = newEmployerReport(r, unresolvedReport, nil)
+
+	byEmployer := make(map[string][]RowResult)
+	for _, row := range r.Rows {
+		if row.Employer == "" {
+			unresolved.Rows = append(unresolved.Rows, row)
+			continue
+		}
+		byEmployer[row.Employer] = append(byEmployer[row.Employer], row)
+	}
+	unresolved.Totals = outcomeTotals(unresolved.Rows)
+
+	employers := make([]string, 0, len(byEmployer))
+	for employer := range byEmployer {
+		employers = append(employers, employer)
+	}
+	sort.Strings(employers)
+
+	for _, employer := range employers {
+		reports = append(reports, newEmployerReport(r, employer, byEmployer[employer]))
+	}
+	return reports, unresolved
+}
+
+func newEmployerReport(r *RunReport, employer string, rows []RowResult) employerReport {
+	return employerReport{
+		Employer:  employer,
+		Source:    r.Source,
+		DryRun:    r.DryRun,
+		Generated: time.Now(),
+		Rows:      rows,
+		Totals:    outcomeTotals(rows),
+	}
+}
+
+// Number of rows for each outcome code, sorted by outcome.
+func outcomeTotals(rows []RowResult) []outcomeTotal {
+	counts := make(map[string]int)
+	for _, row := range rows {
+		counts[row.Outcome]++
+	}
+
+	totals := make([]outcomeTotal, 0, len(counts))
+	for outcome, count := range counts {
+		totals = append(totals, outcomeTotal{outcome, count})
+	}
+	sort.Sort(byOutcome(totals))
+	return totals
+}
+
+type byOutcome []outcomeTotal
+
+func (t byOutcome) Len() int           { return len(t) }
+func (t byOutcome) Swap(i, j int)      { t[i], t[j] = t[j], t[i] }
+func (t byOutcome) Less(i, j int) bool { return t[i].Outcome < t[j].Outcome }
+
+// Write each employer's report, and the unresolved one if any row didn't
+// resolve, to dir as <employer>.csv and <employer>.html. The unresolved
+// report gets "unresolved" first; an employer whose name comes out the
+// same as an earlier one's gets a numbered name, e.g. "unresolved-2".
+func writeEmployerReports(r *RunReport, dir string) error {
+	err := os.MkdirAll(dir, 0700)
+	if err != nil {
+		return err
+	}
+
+	reports, unresolved := employerReports(r)
+	if len(unresolved.Rows) > 0 {
+		reports = append([]employerReport{unresolved}, reports...)
+	}
+
+	used := make(map[string]bool)
+	for _, report := range reports {
+		base := filepath.Join(dir, uniqueFileName(report.Employer, used))
+		err = writeEmployerCSV(base+".csv", report)
+		if err != nil {
+			return err
+		}
+		err = writeEmployerHTML(base+".html", report)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// name made safe for a file name, and numbered if it is already in used,
+// ignoring case for case-insensitive file systems.
+func uniqueFileName(name string, used map[string]bool) string {
+	base := unsafeFileChars.ReplaceAllString(name, "_")
+	unique := base
+	for i := 2; used[strings.ToLower(unique)]; i++ {
+		unique = fmt.Sprintf("%v-%v", base, i)
+	}
+	used[strings.ToLower(unique)] = true
+	return unique
+}
+
+func writeEmployerCSV(filename string, report employerReport) error {
+	rows := [][]string{{"row", "first_name", "last_name", "email", "company", "outcome", "user_id", "date", "message"}}
+	for _, row := range report.Rows {
+		rows = append(rows, []string{
+			strconv.Itoa(row.Row),
+			row.FirstName,
+			row.LastName,
+			row.Email,
+			row.Company,
+			row.Outcome,
+			row.UserId,
+			row.Date.Format("2006-01-02"),
+			row.Message,
+		})
+	}
+
+	rows = append(rows, []string{})
+	for _, total := range report.Totals {
+		rows = append(rows, []string{"total", total.Outcome, strconv.Itoa(total.Count)})
+	}
+	return writeCSV(filename, rows)
+}
+
+func writeEmployerHTML(filename string, report employerReport) error {
+	file, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	return htmlEmployerReport.Execute(file, report)
+}
+
+var htmlEmployerReport = htmltemplate.Must(htmltemplate.New("html").Funcs(reportFuncs).Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>Offboarding summary: {{.Employer}}</title></head>
+<body>
+<h1>Offboarding summary: {{.Employer}}</h1>
+<p>Quit list {{.Source}}, processed {{date .Generated}}.{{if .DryRun}} This was a preview, nothing was deleted.{{end}}</p>
+<h2>Totals</h2>
+<table border="1" cellpadding="4">
+<tr><th>Outcome</th><th>Rows</th></tr>
+{{range .Totals}}<tr><td>{{.Outcome}}</td><td>{{.Count}}</td></tr>
+{{end}}</table>
+<h2>Rows</h2>
+{{if .Rows}}<table border="1" cellpadding="4">
+<tr><th>Row</th><th>Name</th><th>Email</th><th>Outcome</th><th>Matched participant</th><th>Date</th></tr>
+{{range .Rows}}<tr><td>{{.Row}}</td><td>{{.FirstName}} {{.LastName}}</td><td>{{.Email}}</td><td>{{.Outcome}}</td><td>{{.UserId}}</td><td>{{date .Date}}</td></tr>
+{{end}}</table>{{else}}<p>No rows.</p>{{end}}
+</body>
+</html>
+`))
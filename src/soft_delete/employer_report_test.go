@@ -0,0 +1,94 @@
+package main
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestEmployerReports(t *testing.T) {
+	report := NewRunReport("quit.csv", false)
+	report.Rows = []RowResult{
+		{Row: 1, Email: "a@acme.com", Company: "Acme", Employer: "Acme", Outcome: OutcomeDeleted, UserId: "user-a"},
+		{Row: 2, Email: "b@acme.com", Company: "Acme", Employer: "Acme", Outcome: OutcomeNoAssociation},
+		{Row: 3, Email: "c@initech.com", Company: "Initech", Employer: "Initech", Outcome: OutcomeDeleted, UserId: "user-c"},
+		{Row: 4, Email: "d@nowhere.com", Company: "Nowhere", Outcome: OutcomeNoEmployer},
+		{Row: 5, Outcome: OutcomeInvalid},
+		// Stopped before the employer lookup, so a typo isn't an employer
+		{Row: 6, Email: "e@acme.com", Company: "Acme Inc", Outcome: OutcomeNameMismatch},
+		{Row: 7, Email: "f@acme.com", Company: "Acme", Outcome: OutcomeNoEmail},
+	}
+
+	reports, unresolved := employerReports(report)
+	if len(reports) != 2 || reports[0].Employer != "Acme" || len(reports[0].Rows) != 2 || reports[1].Employer != "Initech" {
+		t.Fatalf("Unexpected employer reports: %+v", reports)
+	}
+	if len(unresolved.Rows) != 4 {
+		t.Fatalf("Expected 4 unresolved rows, got %+v", unresolved.Rows)
+	}
+	if len(reports[0].Totals) != 2 || reports[0].Totals[0] != (outcomeTotal{OutcomeDeleted, 1}) {
+		t.Fatalf("Unexpected Acme totals: %v", reports[0].Totals)
+	}
+
+	dir, err := ioutil.TempDir("", "employer_reports")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	err = writeEmployerReports(report, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range []string{"Acme.csv", "Acme.html", "Initech.csv", "Initech.html", "unresolved.csv", "unresolved.html"} {
+		data, err := ioutil.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if name == "Acme.html" && !strings.Contains(string(data), "a@acme.com") {
+			t.Errorf("Acme report missing its rows:\n%s", data)
+		}
+		if name == "Initech.csv" && strings.Contains(string(data), "acme") {
+			t.Errorf("Initech report has another employer's rows:\n%s", data)
+		}
+	}
+}
+
+func TestEmployerReportFileNamesUnique(t *testing.T) {
+	report := NewRunReport("quit.csv", false)
+	report.Rows = []RowResult{
+		{Row: 1, Email: "a@a.com", Employer: "unresolved", Outcome: OutcomeDeleted},
+		{Row: 2, Email: "b@b.com", Employer: "A/B", Outcome: OutcomeDeleted},
+		{Row: 3, Email: "c@c.com", Employer: "A B", Outcome: OutcomeDeleted},
+		{Row: 4, Email: "d@d.com", Outcome: OutcomeNoEmail},
+	}
+
+	dir, err := ioutil.TempDir("", "employer_reports")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	err = writeEmployerReports(report, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := map[string]string{
+		"unresolved.csv":   "d@d.com",
+		"unresolved-2.csv": "a@a.com",
+		"A_B.csv":          "c@c.com",
+		"A_B-2.csv":        "b@b.com",
+	}
+	for name, email := range expected {
+		data, err := ioutil.ReadFile(filepath.Join(dir, name))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(string(data), email) {
+			t.Errorf("Expected %v in %v:\n%s", email, name, data)
+		}
+	}
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"github.com/codegangsta/cli"
+	"log"
+	"soft_delete/configuration"
+	"soft_delete/driver/database"
+	"soft_delete/models"
+	"strings"
+)
+
+var eraseCommand = cli.Command{
+	Name:  "erase",
+	Usage: "Replace users' PII with irreversible tokens, keeping their rows",
+	Flags: []cli.Flag{
+		cli.StringSliceFlag{Name: "user", Value: &cli.StringSlice{}, Usage: "UUID or email of a user to erase (repeatable)"},
+		cli.StringFlag{Name: "file", Usage: "CSV with a UUID or email in the first column of each row"},
+		cli.BoolFlag{Name: "dry-run", Usage: "report what would be scrubbed, but change nothing"},
+		cli.StringFlag{Name: "report", Usage: "write the scrubbed fields per user and table to this CSV file"},
+	},
+	Action: eraseAction,
+}
+
+func eraseAction(c *cli.Context) {
+	users := c.StringSlice("user")
+	if c.String("file") != "" {
+		listed, err := readUserList(c.String("file"))
+		if err != nil {
+			log.Fatal(err)
+		}
+		users = append(users, listed...)
+	}
+	if len(users) == 0 {
+		log.Fatal(errors.New("Error: give --user or --file"))
+	}
+
+	rows := [][]string{{"user", "user_id", "table", "fields"}}
+	pointers := configuration.GetConfiguration().ErasurePointers
+	source, inputHash := "erase", ""
+	if c.String("file") != "" {
+		var err error
+		source = c.String("file")
+		inputHash, err = fileHash(source)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	for _, idOrEmail := range users {
+		user, result, err := eraseUser(idOrEmail, pointers, c.Bool("dry-run"), source, inputHash)
+		if err != nil {
+			log.Print("Error erasing ", idOrEmail, " ~ Err: ", err)
+			rows = append(rows, []string{idOrEmail, "", "", outcomeFor(err) + ": " + err.Error()})
+			continue
+		}
+
+		for _, table := range result.Tables() {
+			log.Print("Erased ", user.UserId, " ", table, ": ", strings.Join(result[table], ", "))
+			rows = append(rows, []string{idOrEmail, user.UserId.String(), table, strings.Join(result[table], ";")})
+		}
+	}
+
+	if c.String("report") != "" {
+		err := writeCSV(c.String("report"), rows)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+}
+
+// Erase one user's PII in its own transaction, rolled back when dryRun.
+// Source and inputHash identify the input in the audit trail.
+func eraseUser(idOrEmail string, pointers []string, dryRun bool, source, inputHash string) (models.User, models.ErasureResult, error) {
+	// Begin TXs
+	app := database.App.Begin()
+	if app.Error != nil {
+		return models.User{}, nil, app.Error
+	}
+
+	user, err := findUser(app, idOrEmail)
+	if err != nil {
+		app.Rollback()
+		return user, nil, fmt.Errorf("No User data for %v: %v", idOrEmail, err)
+	}
+
+	result, err := user.EraseWithTx(pointers, app)
+	if err != nil {
+		app.Rollback()
+		return user, nil, err
+	}
+
+	if dryRun {
+		app.Rollback()
+		return user, result, nil
+	}
+
+	err = audit(app, models.AuditActionErase, source, inputHash, user.UserId, result.Counts())
+	if err != nil {
+		app.Rollback()
+		return user, nil, err
+	}
+
+	err = app.Commit().Error
+	if err != nil {
+		app.Rollback()
+		return user, nil, err
+	}
+	return user, result, nil
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/codegangsta/cli"
+	"github.com/dabfleming/gorm"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"soft_delete/driver/database"
+	"soft_delete/models"
+	"time"
+)
+
+var exportCommand = cli.Command{
+	Name:  "export",
+	Usage: "Write everything held on a user to a self-contained archive",
+	Flags: []cli.Flag{
+		cli.StringFlag{Name: "user", Usage: "UUID or email of the user to export"},
+		cli.StringFlag{Name: "out", Value: ".", Usage: "directory to write the archive to"},
+		cli.BoolFlag{Name: "zip", Usage: "write a zip file instead of a directory"},
+	},
+	Action: exportAction,
+}
+
+// A single file in an export archive.
+type archiveFile struct {
+	Name string
+	Data []byte
+}
+
+var unsafeFileChars = regexp.MustCompile(`[^A-Za-z0-9_.-]+`)
+
+func exportAction(c *cli.Context) {
+	if c.String("user") == "" {
+		log.Fatal(errors.New("Error: --user is required"))
+	}
+
+	user, err := findUser(database.App, c.String("user"))
+	if err != nil {
+		log.Fatalf("No User data for %v: %v", c.String("user"), err)
+	}
+
+	path, err := exportUser(database.App, user.UserId, c.String("out"), c.Bool("zip"))
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	log.Print("Exported ", user.UserId, " to ", path)
+}
+
+// Job type exporting a deleted user's data
+const jobExport = "export"
+
+// Queue an export of user's data, to run once app commits. The graph
+// includes soft deleted rows, so the export is complete as long as it runs
+// before the deletion is finalized.
+func enqueueExport(app *gorm.DB, user models.User, outDir string, zipped bool) (*models.Job, error) {
+	job, err := models.EnqueueJobWithTx(jobExport, models.Metadata{
+		"user_id": user.UserId.String(),
+		"dir":     outDir,
+		"zip":     zipped,
+	}, app)
+	if err != nil {
+		return nil, fmt.Errorf("Error queueing export: %v", err)
+	}
+	return job, nil
+}
+
+// Runs an export job: {"user_id": ..., "dir": ..., "zip": ...}
+func exportJob(payload models.Metadata) error {
+	var userId models.UUID
+	id, _ := payload["user_id"].(string)
+	userId.Parse(id)
+	if userId.UUID == nil {
+		return permanentJobError{fmt.Errorf("Invalid user_id: %v", payload["user_id"])}
+	}
+	dir, _ := payload["dir"].(string)
+	zipped, _ := payload["zip"].(bool)
+
+	path, err := exportUser(database.App, userId, dir, zipped)
+	if err != nil {
+		return err
+	}
+	log.Print("Exported ", userId, " to ", path)
+	return nil
+}
+
+// Load userId's graph through db and write it under outDir. Returns the
+// path of the archive.
+func exportUser(db *gorm.DB, userId models.UUID, outDir string, zipped bool) (string, error) {
+	graph, err := models.LoadUserGraphWithTx(userId, db)
+	if err != nil {
+		return "", fmt.Errorf("Error loading data of %v: %v", userId, err)
+	}
+
+	files, err := archiveFiles(graph)
+	if err != nil {
+		return "", err
+	}
+
+	if zipped {
+		return writeZipArchive(filepath.Join(outDir, graph.UserId+".zip"), files)
+	}
+	return writeDirArchive(filepath.Join(outDir, graph.UserId), files)
+}
+
+// The graph as user.json, each asset under assets/, and a manifest.
+func archiveFiles(graph *models.UserGraph) ([]archiveFile, error) {
+	data, err := json.MarshalIndent(graph, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	files := []archiveFile{{"user.json", data}}
+
+	assets := make([]string, 0, len(graph.Assets))
+	for _, asset := range graph.Assets {
+		name := fmt.Sprintf("assets/%d-%s", asset.ID, unsafeFileChars.ReplaceAllString(asset.Type, "_"))
+		files = append(files, archiveFile{name, asset.Data})
+		assets = append(assets, name)
+	}
+
+	manifest, err := json.MarshalIndent(map[string]interface{}{
+		"user_id":     graph.UserId,
+		"exported_at": time.Now(),
+		"counts": map[string]int{
+			"user_emails":    len(graph.Emails),
+			"user_addresses": len(graph.Addresses),
+			"user_settings":  len(graph.Settings),
+			"user_states":    len(graph.States),
+			"user_logs":      len(graph.Logs),
+			"associations":   len(graph.Associations),
+			"records":        len(graph.Records),
+			"user_assets":    len(graph.Assets),
+		},
+		"assets": assets,
+	}, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	files = append(files, archiveFile{"manifest.json", manifest})
+
+	return files, nil
+}
+
+func writeDirArchive(dir string, files []archiveFile) (string, error) {
+	for _, f := range files {
+		path := filepath.Join(dir, filepath.FromSlash(f.Name))
+		err := os.MkdirAll(filepath.Dir(path), 0700)
+		if err != nil {
+			return "", err
+		}
+		err = ioutil.WriteFile(path, f.Data, 0600)
+		if err != nil {
+			return "", err
+		}
+	}
+	return dir, nil
+}
+
+func writeZipArchive(path string, files []archiveFile) (string, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+
+	w := zip.NewWriter(file)
+	for _, f := range files {
+		entry, err := w.Create(f.Name)
+		if err != nil {
+			return "", err
+		}
+		_, err = entry.Write(f.Data)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	err = w.Close()
+	if err != nil {
+		return "", err
+	}
+	return path, nil
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"github.com/codegangsta/cli"
+	"github.com/dabfleming/gorm"
+	"log"
+	"os"
+	"soft_delete/driver/database"
+	"soft_delete/models"
+	"text/tabwriter"
+	"time"
+)
+
+var holdCommand = cli.Command{
+	Name:  "hold",
+	Usage: "Place, release and list legal holds blocking deletion of a user",
+	Subcommands: []cli.Command{
+		{
+			Name:  "add",
+			Usage: "Place a legal hold on a user",
+			Flags: []cli.Flag{
+				cli.StringFlag{Name: "user", Usage: "UUID or email of the user to hold"},
+				cli.StringFlag{Name: "reason", Usage: "why the user's data must be kept"},
+				cli.StringFlag{Name: "by", Usage: "who requested the hold"},
+				cli.StringFlag{Name: "expires", Usage: "date the hold lapses (YYYY-MM-DD), never if not set"},
+			},
+			Action: holdAddAction,
+		},
+		{
+			Name:  "release",
+			Usage: "Release a user's legal holds",
+			Flags: []cli.Flag{
+				cli.StringFlag{Name: "user", Usage: "UUID or email of the held user"},
+				cli.StringFlag{Name: "by", Usage: "who released the hold"},
+			},
+			Action: holdReleaseAction,
+		},
+		{
+			Name:   "list",
+			Usage:  "List active legal holds",
+			Action: holdListAction,
+		},
+	},
+}
+
+func holdAddAction(c *cli.Context) {
+	if c.String("user") == "" || c.String("reason") == "" || c.String("by") == "" {
+		log.Fatal(errors.New("Error: --user, --reason and --by are required"))
+	}
+
+	var expires time.Time
+	if c.String("expires") != "" {
+		var err error
+		expires, err = time.ParseInLocation(effectiveDateFormat, c.String("expires"), time.Local)
+		if err != nil {
+			log.Fatalf("Invalid --expires %v: %v", c.String("expires"), err)
+		}
+	}
+
+	err := inTransaction(func(app *gorm.DB) error {
+		user, err := findUser(app, c.String("user"))
+		if err != nil {
+			return fmt.Errorf("No User data for %v: %v", c.String("user"), err)
+		}
+
+		hold, err := user.PlaceLegalHoldWithTx(c.String("reason"), c.String("by"), expires, app)
+		if err != nil {
+			return err
+		}
+
+		log.Print("Placed legal hold ", hold.ID, " on ", user.UserId)
+		return nil
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+func holdReleaseAction(c *cli.Context) {
+	if c.String("user") == "" || c.String("by") == "" {
+		log.Fatal(errors.New("Error: --user and --by are required"))
+	}
+
+	err := inTransaction(func(app *gorm.DB) error {
+		user, err := findUser(app, c.String("user"))
+		if err != nil {
+			return fmt.Errorf("No User data for %v: %v", c.String("user"), err)
+		}
+
+		holds, err := user.LegalHoldsWithTx(app)
+		if err != nil {
+			return err
+		}
+		if len(holds) == 0 {
+			return fmt.Errorf("No active legal hold on %v", user.UserId)
+		}
+
+		for i := range holds {
+			err = holds[i].ReleaseWithTx(c.String("by"), app)
+			if err != nil {
+				return err
+			}
+			log.Print("Released legal hold ", holds[i].ID, " on ", user.UserId)
+		}
+		return nil
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+func holdListAction(c *cli.Context) {
+	holds, err := models.ActiveLegalHoldsWithTx(database.App)
+	if err != nil {
+		log.Fatal("Error listing legal holds: ", err)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tUSER\tREASON\tCREATED BY\tCREATED\tEXPIRES")
+	for _, h := range holds {
+		expires := "never"
+		if h.ExpiresAt.Valid {
+			expires = h.ExpiresAt.Time.Format(effectiveDateFormat)
+		}
+		fmt.Fprintf(w, "%v\t%v\t%v\t%v\t%v\t%v\n", h.ID, h.UserId, h.Reason, h.CreatedBy, h.CreatedAt.Format(effectiveDateFormat), expires)
+	}
+	w.Flush()
+}
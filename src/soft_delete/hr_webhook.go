@@ -0,0 +1,343 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/codegangsta/cli"
+	"github.com/dabfleming/gorm"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"soft_delete/configuration"
+	"soft_delete/driver/database"
+	"soft_delete/models"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var serveHRCommand = cli.Command{
+	Name:  "serve-hr",
+	Usage: "Accept signed quit events from employers' HR systems over HTTP",
+	Flags: []cli.Flag{
+		cli.StringFlag{Name: "listen", Value: ":8090", Usage: "address to listen on"},
+		cli.DurationFlag{Name: "interval", Value: 10 * time.Second, Usage: "how often to process received events"},
+	},
+	Action: serveHRAction,
+}
+
+var hrEventsCommand = cli.Command{
+	Name:  "hr-events",
+	Usage: "Process and replay stored HR quit events",
+	Subcommands: []cli.Command{
+		{
+			Name:   "process",
+			Usage:  "Process every received event now",
+			Action: hrEventsProcessAction,
+		},
+		{
+			Name:  "replay",
+			Usage: "Process stored events again",
+			Flags: []cli.Flag{
+				cli.StringSliceFlag{Name: "id", Value: &cli.StringSlice{}, Usage: "id of the event to replay (repeatable)"},
+			},
+			Action: hrEventsReplayAction,
+		},
+	},
+}
+
+// Headers of a signed event. The signature is the hex HMAC-SHA256, under
+// the employer's secret, of "<timestamp>.<event id>.<body>", the timestamp
+// in Unix seconds.
+const (
+	employerHeader  = "X-Employer-Key"
+	timestampHeader = "X-Timestamp"
+	eventIdHeader   = "X-Event-Id"
+	signatureHeader = "X-Signature"
+)
+
+// How far a signed timestamp may be from now before the event is refused
+// as a replay
+const signatureWindow = 5 * time.Minute
+
+// How long an event may be left processing before it is claimed again
+const hrEventStale = 10 * time.Minute
+
+// Largest event body accepted
+const maxEventSize = 1 << 20
+
+// Events processed per poll
+const hrEventBatchSize = 100
+
+// A quit event as posted: the QuitRecord fields, and optionally the
+// employer key, which must then match the header.
+type hrQuitEvent struct {
+	EmployerKey   string `json:"employer_key"`
+	FirstName     string `json:"first_name"`
+	LastName      string `json:"last_name"`
+	Email         string `json:"email"`
+	Company       string `json:"company"`
+	EffectiveDate string `json:"effective_date"`
+	Reason        string `json:"reason"`
+	Notes         string `json:"notes"`
+}
+
+// Verifies and stores quit events. Processing happens separately.
+type hrWebhook struct {
+	employers map[string]configuration.HREmployer
+}
+
+func serveHRAction(c *cli.Context) {
+	go func() {
+		for {
+			err := processHREvents()
+			if err != nil {
+				log.Print("Error processing HR events ~ Err: ", err)
+			}
+			time.Sleep(c.Duration("interval"))
+		}
+	}()
+
+	mux := http.NewServeMux()
+	mux.Handle("/hr/quit", &hrWebhook{employers: configuration.GetConfiguration().HREmployers})
+
+	log.Print("Listening for HR events on ", c.String("listen"))
+	log.Fatal(http.ListenAndServe(c.String("listen"), mux))
+}
+
+func (h *hrWebhook) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		writeJSON(w, http.StatusMethodNotAllowed, models.ErrorResponse{Error: true, Message: "POST a quit event"})
+		return
+	}
+
+	body, err := ioutil.ReadAll(http.MaxBytesReader(w, r.Body, maxEventSize))
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, models.ErrorResponse{Error: true, Message: "Error reading body: " + err.Error()})
+		return
+	}
+
+	// Verified before the body is parsed at all
+	employerKey := r.Header.Get(employerHeader)
+	eventId := r.Header.Get(eventIdHeader)
+	timestamp := r.Header.Get(timestampHeader)
+	employer, ok := h.employers[employerKey]
+	if !ok || eventId == "" || !validSignature(signedMessage(timestamp, eventId, body), r.Header.Get(signatureHeader), employer.Secret) {
+		writeJSON(w, http.StatusUnauthorized, models.ErrorResponse{Error: true, Message: "Unknown employer key, missing event id or bad signature"})
+		return
+	}
+	err = checkTimestamp(timestamp, time.Now())
+	if err != nil {
+		writeJSON(w, http.StatusUnauthorized, models.ErrorResponse{Error: true, Message: err.Error()})
+		return
+	}
+
+	var event hrQuitEvent
+	err = json.Unmarshal(body, &event)
+	if err != nil {
+		writeJSON(w, http.StatusBadRequest, models.ErrorResponse{Error: true, Message: "Error parsing event: " + err.Error()})
+		return
+	}
+	if event.EmployerKey != "" && event.EmployerKey != employerKey {
+		writeJSON(w, http.StatusBadRequest, models.ErrorResponse{Error: true, Message: "employer_key does not match the " + employerHeader + " header"})
+		return
+	}
+
+	existing, err := models.HREventByEventIdWithTx(employerKey, eventId, database.App)
+	if err == nil {
+		writeJSON(w, http.StatusOK, models.SuccessResponse{Success: true, Message: fmt.Sprintf("Event %v already received", existing.ID)})
+		return
+	} else if err != gorm.RecordNotFound {
+		log.Print("Error looking up HR event ", eventId, " from ", employerKey, " ~ Err: ", err)
+		writeJSON(w, http.StatusInternalServerError, models.ErrorResponse{Error: true, Message: "Error storing event"})
+		return
+	}
+
+	var payload models.Metadata
+	json.Unmarshal(body, &payload)
+
+	stored, err := models.NewHREventWithTx(employerKey, eventId, payload, database.App)
+	if err != nil {
+		log.Print("Error storing HR event from ", employerKey, " ~ Err: ", err)
+		writeJSON(w, http.StatusInternalServerError, models.ErrorResponse{Error: true, Message: "Error storing event"})
+		return
+	}
+
+	writeJSON(w, http.StatusAccepted, models.SuccessResponse{Success: true, Message: fmt.Sprintf("Event %v accepted", stored.ID)})
+}
+
+// What an event's signature covers.
+func signedMessage(timestamp, eventId string, body []byte) []byte {
+	return append([]byte(timestamp+"."+eventId+"."), body...)
+}
+
+// Errors unless timestamp, in Unix seconds, is within signatureWindow of now.
+func checkTimestamp(timestamp string, now time.Time) error {
+	seconds, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return errors.New("Missing or invalid " + timestampHeader)
+	}
+	skew := now.Sub(time.Unix(seconds, 0))
+	if skew > signatureWindow || skew < -signatureWindow {
+		return errors.New(timestampHeader + " is outside the accepted window")
+	}
+	return nil
+}
+
+// Whether signature is the hex HMAC-SHA256 of message under secret.
+func validSignature(message []byte, signature, secret string) bool {
+	if secret == "" {
+		return false
+	}
+	expected, err := hex.DecodeString(strings.TrimPrefix(signature, "sha256="))
+	if err != nil {
+		return false
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(message)
+	return hmac.Equal(mac.Sum(nil), expected)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func hrEventsProcessAction(c *cli.Context) {
+	err := processHREvents()
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+func hrEventsReplayAction(c *cli.Context) {
+	if len(c.StringSlice("id")) == 0 {
+		log.Fatal(errors.New("Error: --id is required"))
+	}
+
+	for _, idStr := range c.StringSlice("id") {
+		id, err := strconv.Atoi(idStr)
+		if err != nil {
+			log.Fatalf("Invalid --id %v: %v", idStr, err)
+		}
+
+		var event models.HREvent
+		err = database.App.Where("id = ?", id).First(&event).Error
+		if err != nil {
+			log.Fatalf("No HR event %v: %v", id, err)
+		}
+
+		err = event.ReplayWithTx(database.App)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	err := processHREvents()
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+// Run every received event through the quit flow, recording each outcome
+// on the event. Events are claimed first, so serve-hr and hr-events process
+// running at once don't both process one.
+func processHREvents() error {
+	for {
+		events, err := models.ClaimHREventsWithTx(hrEventBatchSize, hrEventStale, database.App)
+		if err != nil {
+			return fmt.Errorf("Error listing HR events: %v", err)
+		}
+
+		for i := range events {
+			event := &events[i]
+			result := processHREvent(event)
+			log.Print("HR event ", event.ID, " (", result.Outcome, "): ", result.Message)
+
+			status := models.HREventProcessed
+			if result.Outcome == OutcomeError {
+				status = models.HREventFailed
+			}
+			err = event.FinishWithTx(status, result.Outcome, result.Message, database.App)
+			if err != nil {
+				return fmt.Errorf("Error updating HR event %v: %v", event.ID, err)
+			}
+		}
+
+		if len(events) < hrEventBatchSize {
+			return nil
+		}
+	}
+}
+
+// Match and delete (or schedule) the participant an event names, in a run
+// of its own.
+func processHREvent(event *models.HREvent) RowResult {
+	result := RowResult{Row: event.ID}
+
+	employer, ok := configuration.GetConfiguration().HREmployers[event.EmployerKey]
+	if !ok {
+		return result.with(OutcomeInvalid, "Unknown employer key ", event.EmployerKey, " for HR event ", event.ID)
+	}
+
+	qRecord, err := hrQuitRecord(event.Payload, employer)
+	if err != nil {
+		return result.with(OutcomeInvalid, "Invalid HR event ", event.ID, ": ", err)
+	}
+
+	run, err := NewRun(fmt.Sprintf("hr-event:%v", event.ID), RunOptions{})
+	if err != nil {
+		return result.with(OutcomeError, err, " for HR event ", event.ID)
+	}
+
+	payload, _ := json.Marshal(event.Payload)
+	sum := sha256.Sum256(payload)
+	run.InputHash = hex.EncodeToString(sum[:])
+
+	result = run.quitParticipant(qRecord, event.ID)
+	run.notifyEmployers()
+	return result
+}
+
+// Build the QuitRecord an event describes. The company is always the
+// employer's, so one employer can't quit another's participants.
+func hrQuitRecord(payload models.Metadata, employer configuration.HREmployer) (QuitRecord, error) {
+	var event hrQuitEvent
+	raw, _ := json.Marshal(payload)
+	err := json.Unmarshal(raw, &event)
+	if err != nil {
+		return QuitRecord{}, err
+	}
+
+	if event.Email == "" || event.FirstName == "" || event.LastName == "" {
+		return QuitRecord{}, errors.New("first_name, last_name and email are required")
+	}
+	if event.Company != "" && event.Company != employer.Company {
+		return QuitRecord{}, fmt.Errorf("company %v does not match the employer key", event.Company)
+	}
+
+	qRecord := QuitRecord{
+		FirstName: event.FirstName,
+		LastName:  event.LastName,
+		Email:     event.Email,
+		Company:   employer.Company,
+		Reason:    strings.ToLower(event.Reason),
+		Notes:     event.Notes,
+	}
+
+	if event.EffectiveDate != "" {
+		qRecord.EffectiveDate, err = time.ParseInLocation(effectiveDateFormat, event.EffectiveDate, time.Local)
+		if err != nil {
+			return QuitRecord{}, fmt.Errorf("invalid effective_date %v: %v", event.EffectiveDate, err)
+		}
+	}
+	if _, ok := configuration.Reason(qRecord.Reason); qRecord.Reason != "" && !ok {
+		return QuitRecord{}, fmt.Errorf("unknown reason %v", qRecord.Reason)
+	}
+	return qRecord, nil
+}
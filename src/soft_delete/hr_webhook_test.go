@@ -0,0 +1,106 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"soft_delete/configuration"
+	"soft_delete/models"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func sign(message, secret string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(message))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func TestValidSignature(t *testing.T) {
+	body := `{"employer_key":"acme"}`
+	if !validSignature([]byte(body), sign(body, "s3cret"), "s3cret") {
+		t.Fatal("Expected signature to verify")
+	}
+	if !validSignature([]byte(body), "sha256="+sign(body, "s3cret"), "s3cret") {
+		t.Fatal("Expected prefixed signature to verify")
+	}
+	if validSignature([]byte(body), sign(body, "other"), "s3cret") {
+		t.Fatal("Signature under another secret verified")
+	}
+	if validSignature([]byte(body), sign(body, ""), "") {
+		t.Fatal("Signature verified without a secret")
+	}
+}
+
+func TestCheckTimestamp(t *testing.T) {
+	now := time.Now()
+	if err := checkTimestamp(strconv.FormatInt(now.Unix(), 10), now); err != nil {
+		t.Fatal("Expected a current timestamp to pass: ", err)
+	}
+	if err := checkTimestamp(strconv.FormatInt(now.Add(-time.Hour).Unix(), 10), now); err == nil {
+		t.Fatal("Expected an hour old timestamp to be refused")
+	}
+	if err := checkTimestamp(strconv.FormatInt(now.Add(time.Hour).Unix(), 10), now); err == nil {
+		t.Fatal("Expected a timestamp an hour ahead to be refused")
+	}
+	if err := checkTimestamp("", now); err == nil {
+		t.Fatal("Expected a missing timestamp to be refused")
+	}
+}
+
+// A request for the webhook signed under secret at the given time.
+func signedRequest(body, secret string, at time.Time) *http.Request {
+	timestamp := strconv.FormatInt(at.Unix(), 10)
+	req := httptest.NewRequest("POST", "/hr/quit", strings.NewReader(body))
+	req.Header.Set(employerHeader, "acme")
+	req.Header.Set(timestampHeader, timestamp)
+	req.Header.Set(eventIdHeader, "evt-1")
+	req.Header.Set(signatureHeader, sign(string(signedMessage(timestamp, "evt-1", []byte(body))), secret))
+	return req
+}
+
+func TestHRWebhookRejectsBadSignature(t *testing.T) {
+	webhook := &hrWebhook{employers: map[string]configuration.HREmployer{
+		"acme": {Company: "Acme", Secret: "s3cret"},
+	}}
+
+	// Not even valid JSON, but refused for its signature before parsing
+	for _, body := range []string{`{"email":"a@example.com"}`, `not json`} {
+		w := httptest.NewRecorder()
+		webhook.ServeHTTP(w, signedRequest(body, "wrong", time.Now()))
+		if w.Code != http.StatusUnauthorized {
+			t.Fatalf("Expected 401 for %v, got %v: %v", body, w.Code, w.Body.String())
+		}
+	}
+}
+
+func TestHRWebhookRejectsReplay(t *testing.T) {
+	webhook := &hrWebhook{employers: map[string]configuration.HREmployer{
+		"acme": {Company: "Acme", Secret: "s3cret"},
+	}}
+
+	// Correctly signed, but captured an hour ago
+	w := httptest.NewRecorder()
+	webhook.ServeHTTP(w, signedRequest(`{"email":"a@example.com"}`, "s3cret", time.Now().Add(-time.Hour)))
+	if w.Code != http.StatusUnauthorized {
+		t.Fatalf("Expected 401, got %v: %v", w.Code, w.Body.String())
+	}
+}
+
+func TestHRQuitRecord(t *testing.T) {
+	employer := configuration.HREmployer{Company: "Acme", Secret: "s3cret"}
+
+	qRecord, err := hrQuitRecord(models.Metadata{"first_name": "Ada", "last_name": "Lovelace", "email": "ada@example.com"}, employer)
+	if err != nil || qRecord.Company != "Acme" {
+		t.Fatalf("Unexpected record %#v (err: %v)", qRecord, err)
+	}
+
+	_, err = hrQuitRecord(models.Metadata{"first_name": "Ada", "last_name": "Lovelace", "email": "ada@example.com", "company": "Other"}, employer)
+	if err == nil {
+		t.Fatal("Expected a company other than the employer's to be refused")
+	}
+}
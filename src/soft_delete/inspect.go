@@ -0,0 +1,141 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/codegangsta/cli"
+	"io"
+	"log"
+	"os"
+	"soft_delete/driver/database"
+	"soft_delete/models"
+	"sort"
+	"strings"
+	"text/tabwriter"
+)
+
+var inspectCommand = cli.Command{
+	Name:  "inspect",
+	Usage: "Show everything a deletion of one user would touch",
+	Flags: []cli.Flag{
+		cli.StringFlag{Name: "user", Usage: "UUID or email of the user"},
+		cli.StringFlag{Name: "format", Value: "table", Usage: "table or json"},
+	},
+	Action: inspectAction,
+}
+
+func inspectAction(c *cli.Context) {
+	if c.String("user") == "" {
+		log.Fatal(errors.New("Error: --user is required"))
+	}
+
+	user, err := findUser(database.App, c.String("user"))
+	if err != nil {
+		log.Fatalf("No User data for %v: %v", c.String("user"), err)
+	}
+
+	inspection, err := models.InspectUserWithTx(user.UserId, database.App)
+	if err != nil {
+		log.Fatalf("Error inspecting %v: %v", user.UserId, err)
+	}
+
+	err = writeInspection(os.Stdout, inspection, c.String("format"))
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+func writeInspection(w io.Writer, inspection *models.UserInspection, format string) error {
+	switch format {
+	case "json":
+		enc := json.NewEncoder(w)
+		return enc.Encode(inspection)
+	case "table":
+		tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+		writeInspectionTable(tw, inspection)
+		return tw.Flush()
+	}
+	return fmt.Errorf("Error: unknown format %v, expected table or json", format)
+}
+
+func writeInspectionTable(w io.Writer, in *models.UserInspection) {
+	deleted := "no"
+	if in.DeletedAt != nil {
+		deleted = "yes, " + in.DeletedAt.Format("2006-01-02 15:04:05")
+	}
+
+	fmt.Fprintf(w, "User\t%v\n", in.UserId)
+	fmt.Fprintf(w, "Display name\t%v\n", in.User.DisplayName)
+	fmt.Fprintf(w, "Created\t%v\n", in.User.CreatedAt.Format("2006-01-02"))
+	fmt.Fprintf(w, "Deleted\t%v\n", deleted)
+	fmt.Fprintf(w, "Roles\t%v\n", strings.Join(in.Roles, ", "))
+
+	fmt.Fprintf(w, "\nStates\n")
+	for _, state := range in.States {
+		fmt.Fprintf(w, "  %v\t%v\n", state.Type, state.State)
+	}
+
+	fmt.Fprintf(w, "\nEmails\n")
+	for _, email := range in.Emails {
+		verified := ""
+		if email.Verified {
+			verified = "verified"
+		}
+		primary := ""
+		if email.ID == in.User.PrimaryEmailId {
+			primary = "primary"
+		}
+		fmt.Fprintf(w, "  %v\t%v\t%v\n", email.Email, verified, primary)
+	}
+
+	fmt.Fprintf(w, "\nAddresses\n")
+	for _, address := range in.Addresses {
+		fmt.Fprintf(w, "  %v\t%v\n", address.ID, joinNonEmpty([]string{address.Name, address.AddressLine1, address.AddressLine2, address.City, address.State, address.Country, address.Zipcode}, ", "))
+	}
+
+	fmt.Fprintf(w, "\nAssociations\n")
+	for _, assoc := range in.Associations {
+		fmt.Fprintf(w, "  %v\t%v\n", assoc.Type, associationKeys(assoc.Users, in.UserId))
+	}
+
+	fmt.Fprintf(w, "\nRecords\n")
+	for _, count := range in.Records {
+		fmt.Fprintf(w, "  %v\t%v\n", count.Entity, count.Count)
+	}
+
+	fmt.Fprintf(w, "\nAssets\n")
+	for _, asset := range in.Assets {
+		fmt.Fprintf(w, "  %v\t%v\t%v bytes\t%v\n", asset.ID, asset.Type, asset.Bytes, deletedMark(asset.Deleted))
+	}
+
+	fmt.Fprintf(w, "\nSessions\n")
+	for _, session := range in.Sessions {
+		fmt.Fprintf(w, "  %v\t%v\t%v\n", session.ID, session.CreatedAt.Format("2006-01-02 15:04:05"), deletedMark(session.Deleted))
+	}
+
+	fmt.Fprintf(w, "\nCascade\tlive\tdeleted\n")
+	for _, step := range models.UserCascade {
+		fmt.Fprintf(w, "  %v\t%v\t%v\n", step.Table, in.LiveRows[step.Table], in.DeletedRows[step.Table])
+	}
+}
+
+// The keys userId appears under in an association's users, e.g.
+// "participant", sorted.
+func associationKeys(users models.Metadata, userId string) string {
+	keys := make([]string, 0, 1)
+	for key, value := range users {
+		if fmt.Sprintf("%v", value) == userId {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return "as " + strings.Join(keys, ", ")
+}
+
+func deletedMark(deleted bool) string {
+	if deleted {
+		return "deleted"
+	}
+	return ""
+}
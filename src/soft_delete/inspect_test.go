@@ -0,0 +1,57 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"soft_delete/models"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWriteInspection(t *testing.T) {
+	deletedAt := time.Date(2016, 3, 1, 12, 0, 0, 0, time.UTC)
+	inspection := &models.UserInspection{
+		UserId:       "test-user",
+		User:         models.User{DisplayName: "Ada"},
+		Deleted:      true,
+		DeletedAt:    &deletedAt,
+		Roles:        []string{"participant"},
+		Emails:       []models.UserEmail{{Email: "ada@example.com", Verified: true}},
+		Associations: []models.Association{{Type: "participant:employer", Users: models.Metadata{"participant": "test-user", "employer": "acme"}}},
+		Records:      []models.EntityCount{{Entity: "Weight", Count: 3}},
+		Assets:       []models.AssetSize{{ID: 1, Type: "avatar", Bytes: 2048}},
+		LiveRows:     models.CascadeCounts{"users": 0},
+		DeletedRows:  models.CascadeCounts{"users": 1},
+	}
+
+	var table bytes.Buffer
+	err := writeInspection(&table, inspection, "table")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, want := range []string{"yes, 2016-03-01", "participant", "ada@example.com", "as participant", "Weight", "2048 bytes"} {
+		if !strings.Contains(table.String(), want) {
+			t.Errorf("Table missing %q:\n%v", want, table.String())
+		}
+	}
+
+	var raw bytes.Buffer
+	err = writeInspection(&raw, inspection, "json")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var decoded map[string]interface{}
+	err = json.Unmarshal(raw.Bytes(), &decoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decoded["deleted"] != true || decoded["user_id"] != "test-user" {
+		t.Errorf("Unexpected JSON: %v", raw.String())
+	}
+
+	err = writeInspection(&raw, inspection, "xml")
+	if err == nil {
+		t.Error("Expected an unknown format to be refused")
+	}
+}
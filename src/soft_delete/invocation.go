@@ -0,0 +1,86 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"github.com/codegangsta/cli"
+	"os"
+	"runtime"
+	"soft_delete/configuration"
+	"soft_delete/models"
+)
+
+// Set at build time, see the Makefile
+var BuildId string
+
+// Environment variable naming the operator when --operator isn't given
+const operatorEnv = "SOFT_DELETE_OPERATOR"
+
+// Who is running soft_delete, with which build, where and with which
+// config. Recorded in run reports, the audit trail and UserLogs.
+type Invocation struct {
+	Operator   string
+	BuildId    string
+	Host       string
+	ConfigPath string
+}
+
+// Set before any command runs
+var invocation Invocation
+
+var versionCommand = cli.Command{
+	Name:   "version",
+	Usage:  "Print the build metadata",
+	Action: versionAction,
+}
+
+func versionAction(c *cli.Context) {
+	fmt.Printf("build: %v\ngo: %v %v/%v\n", buildIdOrUnknown(), runtime.Version(), runtime.GOOS, runtime.GOARCH)
+}
+
+// Resolve the invocation from --operator, the environment and the host.
+// Outside production the login user stands in for a missing operator.
+func newInvocation(operator string) Invocation {
+	if operator == "" {
+		operator = os.Getenv(operatorEnv)
+	}
+	if operator == "" && !isProduction() {
+		operator = os.Getenv("USER")
+	}
+
+	host, _ := os.Hostname()
+	return Invocation{
+		Operator:   operator,
+		BuildId:    buildIdOrUnknown(),
+		Host:       host,
+		ConfigPath: configuration.Location(),
+	}
+}
+
+// Errors if nobody has said who is running this in production.
+func (i Invocation) Check() error {
+	if i.Operator == "" {
+		return errors.New("Error: --operator or " + operatorEnv + " is required in production")
+	}
+	return nil
+}
+
+func (i Invocation) Metadata() models.Metadata {
+	return models.Metadata{
+		"operator": i.Operator,
+		"build_id": i.BuildId,
+		"host":     i.Host,
+		"config":   i.ConfigPath,
+	}
+}
+
+func isProduction() bool {
+	return configuration.GetConfiguration().Env == "production"
+}
+
+func buildIdOrUnknown() string {
+	if BuildId == "" {
+		return "unknown"
+	}
+	return BuildId
+}
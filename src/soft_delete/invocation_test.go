@@ -0,0 +1,22 @@
+package main
+
+import (
+	"os"
+	"testing"
+)
+
+func TestNewInvocationOperator(t *testing.T) {
+	defer os.Setenv(operatorEnv, os.Getenv(operatorEnv))
+
+	os.Setenv(operatorEnv, "from-env")
+	if op := newInvocation("from-flag").Operator; op != "from-flag" {
+		t.Fatalf("Expected the flag to win, got %v", op)
+	}
+	if op := newInvocation("").Operator; op != "from-env" {
+		t.Fatalf("Expected the environment operator, got %v", op)
+	}
+
+	if err := (Invocation{}).Check(); err == nil {
+		t.Fatal("Expected an invocation without an operator to be refused")
+	}
+}
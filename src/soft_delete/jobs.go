@@ -0,0 +1,189 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/codegangsta/cli"
+	"log"
+	"os"
+	"soft_delete/configuration"
+	"soft_delete/driver/database"
+	"soft_delete/models"
+	"time"
+)
+
+var jobsCommand = cli.Command{
+	Name:  "jobs",
+	Usage: "Work with queued side effects of deletions (deprovisioning, exports, notifications)",
+	Subcommands: []cli.Command{
+		{
+			Name:  "work",
+			Usage: "Run due jobs, retrying failures with backoff",
+			Flags: []cli.Flag{
+				cli.BoolFlag{Name: "follow", Usage: "keep polling for new jobs instead of exiting once none are due"},
+				cli.DurationFlag{Name: "interval", Value: 10 * time.Second, Usage: "how often to poll when following"},
+			},
+			Action: jobsWorkAction,
+		},
+		{
+			Name:  "list",
+			Usage: "List jobs as JSON",
+			Flags: []cli.Flag{
+				cli.StringFlag{Name: "status", Usage: "only jobs in this status (pending, running, done, dead, cancelled)"},
+			},
+			Action: jobsListAction,
+		},
+		{
+			Name:   "retry",
+			Usage:  "Run a dead or cancelled job again with a fresh set of attempts",
+			Flags:  []cli.Flag{cli.IntFlag{Name: "id", Usage: "id of the job"}},
+			Action: jobsRetryAction,
+		},
+		{
+			Name:   "cancel",
+			Usage:  "Stop a pending or dead job from running",
+			Flags:  []cli.Flag{cli.IntFlag{Name: "id", Usage: "id of the job"}},
+			Action: jobsCancelAction,
+		},
+	},
+}
+
+// Runs one job of a type, given its payload.
+type jobHandler func(payload models.Metadata) error
+
+var jobHandlers = map[string]jobHandler{
+	jobDeprovision:       deprovisionJob,
+	jobExport:            exportJob,
+	jobNotifyParticipant: notifyParticipantJob,
+	jobNotifyEmployer:    notifyEmployerJob,
+}
+
+// A failure no retry will fix, e.g. a bad payload. The job is dead-lettered
+// straight away.
+type permanentJobError struct {
+	error
+}
+
+// Running jobs not finished after this long are assumed to belong to a
+// worker that died, and are claimed again
+const jobStaleAfter = time.Hour
+
+func jobsWorkAction(c *cli.Context) {
+	maxAttempts := configuration.GetConfiguration().Jobs.MaxAttempts
+	if maxAttempts <= 0 {
+		maxAttempts = defaultMaxAttempts
+	}
+
+	for {
+		ran, err := workJobs(maxAttempts)
+		if err != nil {
+			log.Fatal(err)
+		}
+		if ran > 0 {
+			log.Print("Ran ", ran, " job(s)")
+		}
+		if !c.Bool("follow") {
+			return
+		}
+		time.Sleep(c.Duration("interval"))
+	}
+}
+
+// Claim and run jobs until none are due. Returns the number of jobs run.
+func workJobs(maxAttempts int) (int, error) {
+	for ran := 0; ; ran++ {
+		job, err := models.ClaimJobWithTx(jobStaleAfter, database.App)
+		if err != nil {
+			return ran, fmt.Errorf("Error claiming job: %v", err)
+		}
+		if job == nil {
+			return ran, nil
+		}
+
+		cause := runJob(job)
+		if cause == nil {
+			err = job.SucceedWithTx(database.App)
+		} else {
+			err = job.FailWithTx(cause, jobRetryAt(job, cause, maxAttempts, time.Now()), database.App)
+			log.Print("Error running ", job.Type, " job ", job.ID, " (attempt ", job.Attempts, ", ", job.Status, ") ~ Err: ", cause)
+		}
+		if err != nil {
+			return ran, fmt.Errorf("Error updating job %v: %v", job.ID, err)
+		}
+	}
+}
+
+func runJob(job *models.Job) error {
+	handler, ok := jobHandlers[job.Type]
+	if !ok {
+		return permanentJobError{fmt.Errorf("Unknown job type %v", job.Type)}
+	}
+	return handler(job.Payload)
+}
+
+// When a failed job runs next, zero if it is dead: permanent failures and
+// jobs out of attempts.
+func jobRetryAt(job *models.Job, cause error, maxAttempts int, now time.Time) time.Time {
+	if _, ok := cause.(permanentJobError); ok {
+		return time.Time{}
+	}
+	if job.Attempts+1 >= maxAttempts {
+		return time.Time{}
+	}
+	return now.Add(retryBackoff(job.Attempts))
+}
+
+func jobsListAction(c *cli.Context) {
+	jobs, err := models.JobsWithTx(c.String("status"), database.App)
+	if err != nil {
+		log.Fatal("Error listing jobs: ", err)
+	}
+
+	enc := json.NewEncoder(os.Stdout)
+	for _, job := range jobs {
+		err = enc.Encode(job)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+}
+
+func jobsRetryAction(c *cli.Context) {
+	job := findJob(c.Int("id"))
+	if job.Status != models.JobDead && job.Status != models.JobCancelled {
+		log.Fatalf("Error: job %v is %v, only dead or cancelled jobs can be retried", job.ID, job.Status)
+	}
+
+	err := job.RetryWithTx(database.App)
+	if err != nil {
+		log.Fatal("Error retrying job: ", err)
+	}
+	log.Print("Queued job ", job.ID, " to run again")
+}
+
+func jobsCancelAction(c *cli.Context) {
+	job := findJob(c.Int("id"))
+	if job.Status != models.JobPending && job.Status != models.JobDead {
+		log.Fatalf("Error: job %v is %v, only pending or dead jobs can be cancelled", job.ID, job.Status)
+	}
+
+	err := job.CancelWithTx(database.App)
+	if err != nil {
+		log.Fatal("Error cancelling job: ", err)
+	}
+	log.Print("Cancelled job ", job.ID)
+}
+
+func findJob(id int) *models.Job {
+	if id == 0 {
+		log.Fatal(errors.New("Error: --id is required"))
+	}
+
+	var job models.Job
+	err := database.App.Where("id = ?", id).First(&job).Error
+	if err != nil {
+		log.Fatalf("No job %v: %v", id, err)
+	}
+	return &job
+}
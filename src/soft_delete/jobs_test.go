@@ -0,0 +1,27 @@
+package main
+
+import (
+	"errors"
+	"soft_delete/models"
+	"testing"
+	"time"
+)
+
+func TestJobRetryAt(t *testing.T) {
+	now := time.Now()
+
+	job := &models.Job{Attempts: 0}
+	if got := jobRetryAt(job, errors.New("timeout"), 3, now); !got.Equal(now.Add(retryBackoff(0))) {
+		t.Errorf("Expected a first failure to retry after %v, got %v", retryBackoff(0), got.Sub(now))
+	}
+
+	job.Attempts = 2
+	if got := jobRetryAt(job, errors.New("timeout"), 3, now); !got.IsZero() {
+		t.Errorf("Expected the last attempt to dead-letter, got a retry at %v", got)
+	}
+
+	job.Attempts = 0
+	if got := jobRetryAt(job, permanentJobError{errors.New("bad payload")}, 3, now); !got.IsZero() {
+		t.Errorf("Expected a permanent failure to dead-letter, got a retry at %v", got)
+	}
+}
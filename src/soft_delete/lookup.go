@@ -0,0 +1,59 @@
+package main
+
+import (
+	"encoding/csv"
+	"github.com/dabfleming/gorm"
+	"io"
+	"os"
+	"soft_delete/models"
+	"strings"
+)
+
+// Looks up a user, deleted or not, by UUID or by any of their emails.
+func findUser(db *gorm.DB, idOrEmail string) (models.User, error) {
+	var user models.User
+	var id models.UUID
+
+	id.Parse(idOrEmail)
+	if id.UUID == nil {
+		var email models.UserEmail
+		err := db.Scopes(models.WithDeleted).Where("email = ?", idOrEmail).Order("id desc").First(&email).Error
+		if err != nil {
+			return user, err
+		}
+		id = email.UserId
+	}
+
+	err := db.Scopes(models.WithDeleted).Where("user_id = ?", id).First(&user).Error
+	return user, err
+}
+
+// Returns the first column of every row after the header, for input files
+// listing one user (UUID or email) per row.
+func readUserList(filename string) ([]string, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	r := csv.NewReader(file)
+	r.FieldsPerRecord = -1
+
+	users := make([]string, 0)
+	for i := 0; ; i++ {
+		row, err := r.Read()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+
+		//Skip header row
+		if i == 0 || len(row) == 0 || strings.TrimSpace(row[0]) == "" {
+			continue
+		}
+		users = append(users, strings.TrimSpace(row[0]))
+	}
+	return users, nil
+}
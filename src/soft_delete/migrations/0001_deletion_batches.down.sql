@@ -0,0 +1,2 @@
+DROP TABLE pending_deletions;
+DROP TABLE deletion_batches;
@@ -0,0 +1,21 @@
+CREATE TABLE deletion_batches (
+    id serial PRIMARY KEY,
+    source text NOT NULL DEFAULT '',
+    meta jsonb,
+    created_at timestamp with time zone NOT NULL,
+    updated_at timestamp with time zone NOT NULL
+);
+
+CREATE TABLE pending_deletions (
+    id serial PRIMARY KEY,
+    user_id uuid NOT NULL,
+    batch_id integer REFERENCES deletion_batches (id),
+    effective_date timestamp with time zone NOT NULL,
+    status varchar(20) NOT NULL,
+    meta jsonb,
+    created_at timestamp with time zone NOT NULL,
+    updated_at timestamp with time zone NOT NULL
+);
+
+CREATE INDEX pending_deletions_status_effective_date_idx ON pending_deletions (status, effective_date);
+CREATE INDEX pending_deletions_user_id_idx ON pending_deletions (user_id);
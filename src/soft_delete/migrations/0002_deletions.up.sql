@@ -0,0 +1,16 @@
+CREATE TABLE deletions (
+    id serial PRIMARY KEY,
+    user_id uuid NOT NULL,
+    batch_id integer REFERENCES deletion_batches (id),
+    state varchar(20) NOT NULL,
+    started_at timestamp with time zone NOT NULL,
+    finished_at timestamp with time zone NOT NULL,
+    grace_until timestamp with time zone NOT NULL,
+    finalized_at timestamp with time zone DEFAULT NULL,
+    meta jsonb,
+    created_at timestamp with time zone NOT NULL,
+    updated_at timestamp with time zone NOT NULL
+);
+
+CREATE INDEX deletions_user_id_idx ON deletions (user_id);
+CREATE INDEX deletions_state_idx ON deletions (state);
@@ -0,0 +1 @@
+DROP TABLE legal_holds;
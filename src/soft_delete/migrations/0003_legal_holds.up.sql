@@ -0,0 +1,13 @@
+CREATE TABLE legal_holds (
+    id serial PRIMARY KEY,
+    user_id uuid NOT NULL,
+    reason text NOT NULL,
+    created_by varchar(100) NOT NULL,
+    expires_at timestamp with time zone DEFAULT NULL,
+    released_at timestamp with time zone DEFAULT NULL,
+    released_by varchar(100),
+    created_at timestamp with time zone NOT NULL,
+    updated_at timestamp with time zone NOT NULL
+);
+
+CREATE INDEX legal_holds_user_id_idx ON legal_holds (user_id);
@@ -0,0 +1,20 @@
+CREATE TABLE audit_entries (
+    id serial PRIMARY KEY,
+    action varchar(20) NOT NULL,
+    operator varchar(100) NOT NULL,
+    host varchar(255) NOT NULL,
+    build_id varchar(100) NOT NULL,
+    source text NOT NULL,
+    input_hash varchar(64) NOT NULL,
+    user_id uuid NOT NULL,
+    counts jsonb NOT NULL,
+    prev_hash varchar(64) NOT NULL,
+    hash varchar(64) NOT NULL,
+    recorded_at timestamp with time zone NOT NULL
+);
+
+CREATE INDEX audit_entries_user_id_idx ON audit_entries (user_id);
+
+-- Append only
+CREATE RULE audit_entries_no_update AS ON UPDATE TO audit_entries DO INSTEAD NOTHING;
+CREATE RULE audit_entries_no_delete AS ON DELETE TO audit_entries DO INSTEAD NOTHING;
@@ -0,0 +1,14 @@
+CREATE TABLE consents (
+    id serial PRIMARY KEY,
+    user_id uuid NOT NULL,
+    type varchar(20) NOT NULL,
+    version varchar(20),
+    source varchar(100),
+    given_at timestamp with time zone DEFAULT NULL,
+    revoked_at timestamp with time zone DEFAULT NULL,
+    revoked_source varchar(100),
+    created_at timestamp with time zone NOT NULL,
+    updated_at timestamp with time zone NOT NULL
+);
+
+CREATE INDEX consents_user_id_idx ON consents (user_id);
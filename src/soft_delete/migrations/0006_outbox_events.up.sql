@@ -0,0 +1,15 @@
+CREATE TABLE outbox_events (
+    id serial PRIMARY KEY,
+    type varchar(50) NOT NULL,
+    user_id uuid NOT NULL,
+    payload jsonb NOT NULL,
+    status varchar(20) NOT NULL,
+    attempts integer NOT NULL DEFAULT 0,
+    next_attempt_at timestamp with time zone NOT NULL,
+    delivered_at timestamp with time zone DEFAULT NULL,
+    last_error text,
+    created_at timestamp with time zone NOT NULL,
+    updated_at timestamp with time zone NOT NULL
+);
+
+CREATE INDEX outbox_events_due_idx ON outbox_events (status, next_attempt_at);
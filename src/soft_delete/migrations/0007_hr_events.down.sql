@@ -0,0 +1 @@
+DROP TABLE hr_events;
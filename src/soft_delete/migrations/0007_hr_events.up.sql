@@ -0,0 +1,14 @@
+CREATE TABLE hr_events (
+    id serial PRIMARY KEY,
+    employer_key varchar(100) NOT NULL,
+    payload jsonb NOT NULL,
+    status varchar(20) NOT NULL,
+    attempts integer NOT NULL DEFAULT 0,
+    outcome varchar(50),
+    message text,
+    processed_at timestamp with time zone DEFAULT NULL,
+    created_at timestamp with time zone NOT NULL,
+    updated_at timestamp with time zone NOT NULL
+);
+
+CREATE INDEX hr_events_status_idx ON hr_events (status);
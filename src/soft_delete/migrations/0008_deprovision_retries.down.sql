@@ -0,0 +1 @@
+DROP TABLE deprovision_retries;
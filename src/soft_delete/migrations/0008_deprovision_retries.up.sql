@@ -0,0 +1,13 @@
+CREATE TABLE deprovision_retries (
+    id serial PRIMARY KEY,
+    user_id uuid NOT NULL,
+    provider varchar(100) NOT NULL,
+    status varchar(20) NOT NULL,
+    attempts integer NOT NULL DEFAULT 0,
+    next_attempt_at timestamp with time zone NOT NULL,
+    last_error text,
+    created_at timestamp with time zone NOT NULL,
+    updated_at timestamp with time zone NOT NULL
+);
+
+CREATE INDEX deprovision_retries_due_idx ON deprovision_retries (status, next_attempt_at);
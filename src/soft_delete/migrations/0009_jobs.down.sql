@@ -0,0 +1,25 @@
+CREATE TABLE deprovision_retries (
+    id serial PRIMARY KEY,
+    user_id uuid NOT NULL,
+    provider varchar(100) NOT NULL,
+    status varchar(20) NOT NULL,
+    attempts integer NOT NULL DEFAULT 0,
+    next_attempt_at timestamp with time zone NOT NULL,
+    last_error text,
+    created_at timestamp with time zone NOT NULL,
+    updated_at timestamp with time zone NOT NULL
+);
+
+CREATE INDEX deprovision_retries_due_idx ON deprovision_retries (status, next_attempt_at);
+
+-- Deprovisioning jobs not yet done go back to being retries; other job
+-- types had no table before and are dropped with jobs
+INSERT INTO deprovision_retries (user_id, provider, status, attempts, next_attempt_at, last_error, created_at, updated_at)
+SELECT (payload->>'user_id')::uuid,
+       payload->>'provider',
+       CASE status WHEN 'dead' THEN 'failed' ELSE 'pending' END,
+       attempts, next_run_at, last_error, created_at, updated_at
+FROM jobs
+WHERE type = 'deprovision' AND status NOT IN ('done', 'cancelled');
+
+DROP TABLE jobs;
@@ -0,0 +1,25 @@
+CREATE TABLE jobs (
+    id serial PRIMARY KEY,
+    type varchar(50) NOT NULL,
+    payload jsonb NOT NULL,
+    status varchar(20) NOT NULL,
+    attempts integer NOT NULL DEFAULT 0,
+    next_run_at timestamp with time zone NOT NULL,
+    locked_at timestamp with time zone DEFAULT NULL,
+    last_error text,
+    created_at timestamp with time zone NOT NULL,
+    updated_at timestamp with time zone NOT NULL
+);
+
+CREATE INDEX jobs_due_idx ON jobs (status, next_run_at);
+
+-- Queued deprovisionings become jobs
+INSERT INTO jobs (type, payload, status, attempts, next_run_at, last_error, created_at, updated_at)
+SELECT 'deprovision',
+       jsonb_build_object('user_id', user_id, 'provider', provider),
+       CASE status WHEN 'failed' THEN 'dead' ELSE status END,
+       attempts, next_attempt_at, last_error, created_at, updated_at
+FROM deprovision_retries
+WHERE status <> 'done';
+
+DROP TABLE deprovision_retries;
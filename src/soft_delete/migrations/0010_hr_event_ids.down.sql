@@ -0,0 +1,6 @@
+DROP INDEX hr_events_event_id_idx;
+
+-- Events claimed but not finished go back to be processed
+UPDATE hr_events SET status = 'received' WHERE status = 'processing';
+
+ALTER TABLE hr_events DROP COLUMN event_id;
@@ -0,0 +1,4 @@
+-- Employers' own event IDs, so a resent event is stored once
+ALTER TABLE hr_events ADD COLUMN event_id varchar(100);
+
+CREATE UNIQUE INDEX hr_events_event_id_idx ON hr_events (employer_key, event_id);
@@ -0,0 +1,148 @@
+package models
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"github.com/dabfleming/gorm"
+	"strings"
+	"time"
+)
+
+// Audited actions
+const (
+	AuditActionQuit    = "quit"
+	AuditActionRestore = "restore"
+	// A restore of a finalized deletion, past its grace period
+	AuditActionRestoreFinal = "restore_final"
+	AuditActionErase        = "erase"
+	AuditActionGenetics     = "erase_genetics"
+	AuditActionFinalize     = "finalize"
+	AuditActionPurge        = "purge"
+	AuditActionRepair       = "repair"
+)
+
+// One deletion or restore, as recorded in the append-only audit trail.
+// Entries are never updated, deleted or part of UserCascade. Each carries
+// the hash of the entry before it, so editing or removing any entry breaks
+// the chain from there on. RecordedAt is set here rather than through
+// Timestamps so it is part of the hash.
+type AuditEntry struct {
+	ID         int       `json:"id"`
+	Action     string    `sql:"size:20" json:"action"`
+	Operator   string    `sql:"size:100" json:"operator"`
+	Host       string    `sql:"size:255" json:"host"`
+	BuildId    string    `sql:"size:100" json:"build_id"`
+	Source     string    `json:"source"`
+	InputHash  string    `sql:"size:64" json:"input_hash"`
+	UserId     UUID      `sql:"type:uuid" json:"-"`
+	Counts     Metadata  `sql:"type:jsonb" json:"counts"`
+	PrevHash   string    `sql:"size:64" json:"prev_hash"`
+	Hash       string    `sql:"size:64" json:"hash"`
+	RecordedAt time.Time `json:"recorded_at"`
+}
+
+// sha256 over every field but ID and Hash. Counts are hashed as JSON,
+// whose map keys are sorted, and RecordedAt at the microsecond precision
+// Postgres stores it with.
+func (e *AuditEntry) ComputeHash() (string, error) {
+	counts, err := json.Marshal(e.Counts)
+	if err != nil {
+		return "", err
+	}
+
+	fields := []string{
+		e.PrevHash,
+		e.Action,
+		e.Operator,
+		e.Host,
+		e.BuildId,
+		e.Source,
+		e.InputHash,
+		e.UserId.String(),
+		string(counts),
+		e.RecordedAt.UTC().Format(time.RFC3339Nano),
+	}
+	sum := sha256.Sum256([]byte(strings.Join(fields, "\x1f")))
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// Chain entry onto the last one and insert it. The table is locked until
+// tx ends so concurrent runs can't fork the chain; commit the entry with
+// the operation it audits.
+func AppendAuditEntryWithTx(entry *AuditEntry, tx *gorm.DB) error {
+	err := tx.Exec("LOCK TABLE audit_entries IN SHARE ROW EXCLUSIVE MODE").Error
+	if err != nil {
+		return fmt.Errorf("Error locking audit trail: %v", err)
+	}
+
+	var last AuditEntry
+	err = tx.Order("id desc").First(&last).Error
+	if err != nil && err != gorm.RecordNotFound {
+		return fmt.Errorf("Error reading audit trail: %v", err)
+	}
+
+	if entry.Counts == nil {
+		entry.Counts = Metadata{}
+	}
+	entry.PrevHash = last.Hash
+	entry.RecordedAt = time.Now().UTC().Truncate(time.Microsecond)
+	entry.Hash, err = entry.ComputeHash()
+	if err != nil {
+		return err
+	}
+
+	return tx.Create(entry).Error
+}
+
+// Where and why the audit chain doesn't check out.
+type AuditBreak struct {
+	EntryId int
+	Reason  string
+}
+
+func (b AuditBreak) Error() string {
+	return fmt.Sprintf("Audit entry %v: %v", b.EntryId, b.Reason)
+}
+
+// Walk the audit trail in order, checking each entry's hash and its link
+// to the one before. Returns the number of entries checked and the first
+// break found, nil if the chain is intact.
+func VerifyAuditChainWithTx(tx *gorm.DB) (int, *AuditBreak, error) {
+	const pageSize = 1000
+
+	checked := 0
+	lastId := 0
+	prevHash := ""
+	for {
+		var page []AuditEntry
+		err := tx.Where("id > ?", lastId).Order("id").Limit(pageSize).Find(&page).Error
+		if err != nil && err != gorm.RecordNotFound {
+			return checked, nil, err
+		}
+
+		for i := range page {
+			entry := &page[i]
+			if entry.PrevHash != prevHash {
+				return checked, &AuditBreak{entry.ID, "previous hash does not match the entry before it"}, nil
+			}
+
+			hash, err := entry.ComputeHash()
+			if err != nil {
+				return checked, nil, err
+			}
+			if hash != entry.Hash {
+				return checked, &AuditBreak{entry.ID, "contents do not match its hash"}, nil
+			}
+
+			checked++
+			lastId = entry.ID
+			prevHash = entry.Hash
+		}
+
+		if len(page) < pageSize {
+			return checked, nil, nil
+		}
+	}
+}
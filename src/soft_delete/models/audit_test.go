@@ -0,0 +1,51 @@
+package models
+
+import (
+	"soft_delete/driver/database"
+	"testing"
+)
+
+func TestAuditChain(t *testing.T) {
+	var user User
+
+	tx := database.App.Begin()
+	defer tx.Rollback()
+
+	err := tx.First(&user).Error
+	if err != nil {
+		t.Fatal("Couldn't get a user: ", err)
+	}
+
+	first := AuditEntry{Action: AuditActionQuit, Operator: "audit_test", UserId: user.UserId, Counts: Metadata{"users": 1}}
+	err = AppendAuditEntryWithTx(&first, tx)
+	if err != nil {
+		t.Fatal("Couldn't append audit entry: ", err)
+	}
+
+	second := AuditEntry{Action: AuditActionRestore, Operator: "audit_test", UserId: user.UserId, Counts: Metadata{"users": 1}}
+	err = AppendAuditEntryWithTx(&second, tx)
+	if err != nil {
+		t.Fatal("Couldn't append audit entry: ", err)
+	}
+	if second.PrevHash != first.Hash {
+		t.Fatalf("Expected entry to chain onto %v, got %v", first.Hash, second.PrevHash)
+	}
+
+	_, broken, err := VerifyAuditChainWithTx(tx)
+	if err != nil {
+		t.Fatal("Couldn't verify audit trail: ", err)
+	}
+	if broken != nil {
+		t.Fatal("Audit trail broken: ", broken)
+	}
+
+	tampered := second
+	tampered.Operator = "someone else"
+	hash, err := tampered.ComputeHash()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hash == second.Hash {
+		t.Fatal("Changing the operator did not change the hash")
+	}
+}
@@ -0,0 +1,104 @@
+package models
+
+import (
+	"fmt"
+	"github.com/dabfleming/gorm"
+	"reflect"
+	"time"
+)
+
+// One table touched when a user is soft-deleted. Where is applied with
+// the user's UUID as its only argument.
+type CascadeStep struct {
+	Table string
+	Model interface{}
+	Where string
+}
+
+// Rows affected in each cascade table.
+type CascadeCounts map[string]int64
+
+// As Metadata, for storing alongside a deletion or audit entry.
+func (c CascadeCounts) Metadata() Metadata {
+	meta := Metadata{}
+	for table, count := range c {
+		meta[table] = count
+	}
+	return meta
+}
+
+// Rows the cascade leaves in place, as IDs by table.
+type CascadeKeep map[string][]int
+
+// Every table soft-deleted when a user is offboarded, in order.
+var UserCascade = []CascadeStep{
+	{"users", &User{}, "user_id = ?"},
+	{"user_states", &UserState{}, "user_id = ?"},
+	{"user_settings", &UserSettings{}, "user_id = ?"},
+	{"user_emails", &UserEmail{}, "user_id = ?"},
+	{"user_logs", &UserLog{}, "user_id = ?"},
+	{"user_addresses", &UserAddress{}, "user_id = ?"},
+	{"associations", &Association{}, "(users #>> '{participant}')::uuid = ?"},
+	{"records", &Record{}, "user_id = ?"},
+}
+
+// The user's rows in step's table soft deleted between from and to, each
+// a new step.Model with only its ID set, to restore or force delete.
+func (step CascadeStep) DeletedRowsWithTx(userId UUID, from, to time.Time, tx *gorm.DB) ([]SoftDeletable, error) {
+	var ids []int
+	err := tx.Scopes(DeletedBetween(from, to)).Model(step.Model).Where(step.Where, userId).Pluck("id", &ids).Error
+	if err != nil && err != gorm.RecordNotFound {
+		return nil, err
+	}
+
+	modelType := reflect.TypeOf(step.Model).Elem()
+	rows := make([]SoftDeletable, len(ids))
+	for i, id := range ids {
+		row := reflect.New(modelType)
+		row.Elem().FieldByName("ID").SetInt(int64(id))
+		rows[i] = row.Interface().(SoftDeletable)
+	}
+	return rows, nil
+}
+
+// Soft-delete the user and everything in UserCascade belonging to them,
+// except the rows in keep, emitting UserSoftDeleted and a RecordDeleted per
+// record. Refused with a *LegalHoldError if the user is held. Nothing is
+// committed; the caller owns tx.
+func (u *User) SoftDeleteWithTx(keep CascadeKeep, tx *gorm.DB) (CascadeCounts, error) {
+	err := u.CheckLegalHoldWithTx(tx)
+	if err != nil {
+		return nil, err
+	}
+
+	var recordIds []int
+	err = tx.Model(&Record{}).Where("user_id = ?", u.UserId).Pluck("id", &recordIds).Error
+	if err != nil && err != gorm.RecordNotFound {
+		return nil, err
+	}
+
+	counts := CascadeCounts{}
+	for _, step := range UserCascade {
+		query := tx.Where(step.Where, u.UserId)
+		if ids := keep[step.Table]; len(ids) > 0 {
+			query = query.Where("id NOT IN (?)", ids)
+		}
+		deleted := query.Delete(step.Model)
+		if deleted.Error != nil {
+			return nil, fmt.Errorf("Error deleting %v: %v", step.Table, deleted.Error)
+		}
+		counts[step.Table] = deleted.RowsAffected
+	}
+
+	err = EmitEventWithTx(EventUserSoftDeleted, u.UserId, Metadata{"counts": counts.Metadata()}, tx)
+	if err != nil {
+		return nil, err
+	}
+	for _, id := range recordIds {
+		err = EmitEventWithTx(EventRecordDeleted, u.UserId, Metadata{"record_id": id}, tx)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return counts, nil
+}
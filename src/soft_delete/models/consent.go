@@ -0,0 +1,178 @@
+package models
+
+import (
+	"fmt"
+	"github.com/dabfleming/gorm"
+	"time"
+)
+
+// Consent types, as captured at registration (ExpressConsentCSA and
+// ExpressConsentGenetic)
+const (
+	ConsentCSA     = "csa"
+	ConsentGenetic = "genetic"
+)
+
+// A consent given by a user, and its revocation if they withdrew it.
+// Consents are kept when the user is deleted as the record of what they
+// agreed to and when.
+type Consent struct {
+	ID            int      `json:"id"`
+	UserId        UUID     `sql:"type:uuid" json:"-"`
+	Type          string   `sql:"size:20" json:"type"`
+	Version       string   `sql:"size:20" json:"version"`
+	Source        string   `sql:"size:100" json:"source"`
+	GivenAt       NullTime `sql:"default:NULL" json:"given_at"`
+	RevokedAt     NullTime `sql:"default:NULL" json:"revoked_at"`
+	RevokedSource string   `sql:"size:100" json:"revoked_source"`
+	Timestamps
+}
+
+func IsConsentType(consentType string) bool {
+	return consentType == ConsentCSA || consentType == ConsentGenetic
+}
+
+// Record the user giving a version of a consent.
+func (u *User) GiveConsentWithTx(consentType, version, source string, at time.Time, tx *gorm.DB) (*Consent, error) {
+	consent := Consent{
+		UserId:  u.UserId,
+		Type:    consentType,
+		Version: version,
+		Source:  source,
+		GivenAt: NullTime{Time: at, Valid: !at.IsZero()},
+	}
+	err := tx.Create(&consent).Error
+	if err != nil {
+		return nil, err
+	}
+	return &consent, nil
+}
+
+// Returns the user's consents that haven't been revoked.
+func (u *User) ConsentsWithTx(tx *gorm.DB) ([]Consent, error) {
+	var consents []Consent
+	err := tx.Where("user_id = ? AND revoked_at IS NULL", u.UserId).Order("id").Find(&consents).Error
+	if err != nil && err != gorm.RecordNotFound {
+		return nil, err
+	}
+	return consents, nil
+}
+
+// Revoke every consent of the type the user has given and log it. A
+// revocation is recorded even if no consent of the type is on file, as
+// consents given before they were tracked aren't.
+func (u *User) RevokeConsentWithTx(consentType, source string, at time.Time, tx *gorm.DB) error {
+	revoked := tx.Model(&Consent{}).Where("user_id = ? AND type = ? AND revoked_at IS NULL", u.UserId, consentType).UpdateColumns(map[string]interface{}{
+		"revoked_at":     at,
+		"revoked_source": source,
+	})
+	if revoked.Error != nil {
+		return revoked.Error
+	}
+
+	if revoked.RowsAffected == 0 {
+		consent := Consent{
+			UserId:        u.UserId,
+			Type:          consentType,
+			RevokedAt:     NullTime{Time: at, Valid: true},
+			RevokedSource: source,
+		}
+		err := tx.Create(&consent).Error
+		if err != nil {
+			return err
+		}
+	}
+
+	meta := Metadata{"type": consentType, "source": source, "revoked_at": at}
+	return u.AddLogWithTx("consent.revoked", "Consent revoked: "+consentType, meta, tx)
+}
+
+// Erase the user's genetics data: records of the given entities have their
+// measure data and meta blanked and are soft deleted, emitting
+// RecordDeleted, and the pointers are erased from the Meta of the user and
+// their other records. Refused with a *LegalHoldError if the user is held.
+func (u *User) EraseGeneticsWithTx(entities, pointers []string, tx *gorm.DB) (ErasureResult, error) {
+	err := u.CheckLegalHoldWithTx(tx)
+	if err != nil {
+		return nil, err
+	}
+
+	result := ErasureResult{}
+	db := tx.Scopes(WithDeleted)
+
+	if len(entities) > 0 {
+		var recordIds []int
+		err = db.Model(&Record{}).Where("user_id = ? AND "+LiveCondition+" AND entity_id IN (SELECT id FROM entities WHERE name IN (?))", u.UserId, entities).Pluck("id", &recordIds).Error
+		if err != nil && err != gorm.RecordNotFound {
+			return nil, err
+		}
+
+		genetics := db.Table("records").Where("user_id = ? AND entity_id IN (SELECT id FROM entities WHERE name IN (?))", u.UserId, entities).UpdateColumns(map[string]interface{}{
+			"measure_data": MeasureInfo{},
+			"meta":         Metadata{},
+		})
+		if genetics.Error != nil {
+			return nil, fmt.Errorf("Error erasing genetics records: %v", genetics.Error)
+		}
+		if genetics.RowsAffected > 0 {
+			result.add("records", "measure_data")
+			result.add("records", "meta")
+		}
+
+		// Only live records are stamped; ones a quit already deleted keep
+		// their deleted_at so they stay in that deletion's window
+		if len(recordIds) > 0 {
+			err = db.Table("records").Where("id IN (?)", recordIds).UpdateColumn("deleted_at", time.Now()).Error
+			if err != nil {
+				return nil, fmt.Errorf("Error deleting genetics records: %v", err)
+			}
+		}
+
+		for _, id := range recordIds {
+			err = EmitEventWithTx(EventRecordDeleted, u.UserId, Metadata{"record_id": id, "consent_revoked": ConsentGenetic}, tx)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	var users []User
+	err = db.Where("user_id = ?", u.UserId).Find(&users).Error
+	if err != nil && err != gorm.RecordNotFound {
+		return nil, err
+	}
+	for _, user := range users {
+		erased := EraseMeta(user.Meta, pointers)
+		if len(erased) == 0 {
+			continue
+		}
+		err = db.Table("users").Where("id = ?", user.ID).UpdateColumn("meta", user.Meta).Error
+		if err != nil {
+			return nil, fmt.Errorf("Error erasing users: %v", err)
+		}
+		for _, pointer := range erased {
+			result.add("users", "meta"+pointer)
+		}
+	}
+
+	var records []Record
+	err = db.Where("user_id = ?", u.UserId).Find(&records).Error
+	if err != nil && err != gorm.RecordNotFound {
+		return nil, err
+	}
+	for _, record := range records {
+		erased := EraseMeta(record.Meta, pointers)
+		if len(erased) == 0 {
+			continue
+		}
+		err = db.Table("records").Where("id = ?", record.ID).UpdateColumn("meta", record.Meta).Error
+		if err != nil {
+			return nil, fmt.Errorf("Error erasing records: %v", err)
+		}
+		for _, pointer := range erased {
+			result.add("records", "meta"+pointer)
+		}
+	}
+
+	return result, nil
+}
@@ -0,0 +1,39 @@
+package models
+
+import (
+	"soft_delete/driver/database"
+	"testing"
+	"time"
+)
+
+func TestRevokeConsent(t *testing.T) {
+	var user User
+
+	tx := database.App.Begin()
+	defer tx.Rollback()
+
+	err := tx.First(&user).Error
+	if err != nil {
+		t.Fatal("Couldn't get a user: ", err)
+	}
+
+	_, err = user.GiveConsentWithTx(ConsentGenetic, "v1", "consent_test", time.Now(), tx)
+	if err != nil {
+		t.Fatal("Couldn't give consent: ", err)
+	}
+
+	err = user.RevokeConsentWithTx(ConsentGenetic, "consent_test", time.Now(), tx)
+	if err != nil {
+		t.Fatal("Couldn't revoke consent: ", err)
+	}
+
+	consents, err := user.ConsentsWithTx(tx)
+	if err != nil {
+		t.Fatal("Couldn't list consents: ", err)
+	}
+	for _, consent := range consents {
+		if consent.Type == ConsentGenetic {
+			t.Fatalf("Genetic consent %v still active after revoking", consent.ID)
+		}
+	}
+}
@@ -0,0 +1,259 @@
+package models
+
+import (
+	"fmt"
+	"github.com/dabfleming/gorm"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Kinds of partial deletion. Live rows are checked for every UserCascade
+// table but users, e.g. "live_records".
+const (
+	// A deleted user's rows in a cascade table that are still live
+	InconsistentLivePrefix = "live_"
+	// A deleted user's primary email that is still live
+	InconsistentPrimaryEmail = "live_primary_email"
+	// A live association naming a deleted user under a key other than
+	// participant, e.g. their coach
+	InconsistentAssociation = "association_to_deleted_user"
+	// A restored user's rows the restore missed
+	InconsistentNotRestored = "not_restored_"
+	// A live user's rows deleted together in two or more cascade tables,
+	// by a cascade that failed before deletions were recorded
+	InconsistentOrphanDeleted = "orphan_deleted_"
+)
+
+// Users checked per query
+const consistencyPageSize = 500
+
+// Rows of one user left inconsistent in one table. Fixing soft deletes
+// them as of DeletedAt, completing the deletion, or undeletes them if
+// DeletedAt is zero, completing a restore.
+type ConsistencyFinding struct {
+	Category  string    `json:"category"`
+	UserId    UUID      `json:"user_id"`
+	Table     string    `json:"table"`
+	RowIds    []int     `json:"row_ids"`
+	DeletedAt time.Time `json:"deleted_at"`
+}
+
+// Whether fixing the finding undeletes its rows.
+func (f ConsistencyFinding) Undo() bool {
+	return f.DeletedAt.IsZero()
+}
+
+// Whether the finding is only a guess, as orphan deleted rows are: rows a
+// live user deleted through the app together look just the same, so they
+// shouldn't be fixed without someone looking first.
+func (f ConsistencyFinding) Guessed() bool {
+	return strings.HasPrefix(f.Category, InconsistentOrphanDeleted)
+}
+
+func (f ConsistencyFinding) FixWithTx(tx *gorm.DB) error {
+	var deletedAt interface{}
+	if !f.Undo() {
+		deletedAt = f.DeletedAt
+	}
+	err := tx.Table(f.Table).Where("id IN (?)", f.RowIds).UpdateColumn("deleted_at", deletedAt).Error
+	if err != nil {
+		return fmt.Errorf("Error fixing %v: %v", f.Table, err)
+	}
+	return nil
+}
+
+// Rows MarkQuitWithTx leaves live on deleted users on purpose, by table.
+var cascadeKept = map[string]func(*gorm.DB) *gorm.DB{
+	"user_states": func(db *gorm.DB) *gorm.DB {
+		return db.Where("NOT (type = ? AND state = ?)", StatusStateType, StatusQuit)
+	},
+	"user_logs": func(db *gorm.DB) *gorm.DB {
+		return db.Where("name <> ?", OffboardingLogName)
+	},
+}
+
+// Scan every deleted user, and every restored one, for rows the cascade
+// missed, and live users with no recorded deletion for rows a failed
+// cascade left deleted.
+func CheckConsistencyWithTx(tx *gorm.DB) ([]ConsistencyFinding, error) {
+	findings := make([]ConsistencyFinding, 0)
+
+	lastId := 0
+	for {
+		var users []User
+		err := tx.Scopes(OnlyDeleted).Where("id > ?", lastId).Order("id").Limit(consistencyPageSize).Find(&users).Error
+		if err != nil && err != gorm.RecordNotFound {
+			return nil, err
+		}
+		for i := range users {
+			found, err := checkDeletedUserWithTx(&users[i], tx)
+			if err != nil {
+				return nil, err
+			}
+			findings = append(findings, found...)
+			lastId = users[i].ID
+		}
+		if len(users) < consistencyPageSize {
+			break
+		}
+	}
+
+	lastId = 0
+	for {
+		var users []User
+		err := tx.Where("id > ? AND NOT EXISTS (SELECT 1 FROM deletions WHERE deletions.user_id = users.user_id)", lastId).Order("id").Limit(consistencyPageSize).Find(&users).Error
+		if err != nil && err != gorm.RecordNotFound {
+			return nil, err
+		}
+		for i := range users {
+			found, err := checkOrphanedRowsWithTx(&users[i], tx)
+			if err != nil {
+				return nil, err
+			}
+			findings = append(findings, found...)
+			lastId = users[i].ID
+		}
+		if len(users) < consistencyPageSize {
+			break
+		}
+	}
+
+	var deletions []Deletion
+	err := tx.Where("state = ?", DeletionStateRestored).Order("id").Find(&deletions).Error
+	if err != nil && err != gorm.RecordNotFound {
+		return nil, err
+	}
+	for i := range deletions {
+		found, err := checkRestoredUserWithTx(&deletions[i], tx)
+		if err != nil {
+			return nil, err
+		}
+		findings = append(findings, found...)
+	}
+	return findings, nil
+}
+
+func checkDeletedUserWithTx(user *User, tx *gorm.DB) ([]ConsistencyFinding, error) {
+	findings := make([]ConsistencyFinding, 0)
+	found := func(category, table string, ids []int) {
+		if len(ids) > 0 {
+			findings = append(findings, ConsistencyFinding{category, user.UserId, table, ids, user.DeletedAt.Time})
+		}
+	}
+
+	for _, step := range UserCascade {
+		if step.Table == "users" {
+			continue
+		}
+
+		query := tx.Model(step.Model).Where(step.Where, user.UserId)
+		if kept, ok := cascadeKept[step.Table]; ok {
+			query = query.Scopes(kept)
+		}
+		if step.Table == "user_emails" && user.PrimaryEmailId != 0 {
+			query = query.Where("id <> ?", user.PrimaryEmailId)
+		}
+
+		var ids []int
+		err := query.Pluck("id", &ids).Error
+		if err != nil && err != gorm.RecordNotFound {
+			return nil, fmt.Errorf("Error checking %v: %v", step.Table, err)
+		}
+		found(InconsistentLivePrefix+step.Table, step.Table, ids)
+	}
+
+	if user.PrimaryEmailId != 0 {
+		var ids []int
+		err := tx.Model(&UserEmail{}).Where("id = ?", user.PrimaryEmailId).Pluck("id", &ids).Error
+		if err != nil && err != gorm.RecordNotFound {
+			return nil, fmt.Errorf("Error checking primary email: %v", err)
+		}
+		found(InconsistentPrimaryEmail, "user_emails", ids)
+	}
+
+	var ids []int
+	err := tx.Model(&Association{}).Where("EXISTS (SELECT 1 FROM jsonb_each_text(users) WHERE key <> 'participant' AND value = ?)", user.UserId.String()).Pluck("id", &ids).Error
+	if err != nil && err != gorm.RecordNotFound {
+		return nil, fmt.Errorf("Error checking associations: %v", err)
+	}
+	found(InconsistentAssociation, "associations", ids)
+
+	return findings, nil
+}
+
+// Rows deleted with d, a restored deletion, that are still deleted though
+// the user is live.
+func checkRestoredUserWithTx(d *Deletion, tx *gorm.DB) ([]ConsistencyFinding, error) {
+	var user User
+	err := tx.Where("user_id = ?", d.UserId).First(&user).Error
+	if err == gorm.RecordNotFound {
+		// Deleted again since, or purged
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	findings := make([]ConsistencyFinding, 0)
+	for _, step := range UserCascade {
+		var ids []int
+		err = tx.Scopes(DeletedBetween(d.StartedAt, d.FinishedAt)).Model(step.Model).Where(step.Where, d.UserId).Pluck("id", &ids).Error
+		if err != nil && err != gorm.RecordNotFound {
+			return nil, fmt.Errorf("Error checking %v: %v", step.Table, err)
+		}
+		if len(ids) > 0 {
+			findings = append(findings, ConsistencyFinding{Category: InconsistentNotRestored + step.Table, UserId: d.UserId, Table: step.Table, RowIds: ids})
+		}
+	}
+	return findings, nil
+}
+
+// Rows of user, a live user with no recorded deletion, soft deleted in the
+// same minute as rows of another cascade table. A user's own edits touch
+// one table at a time; a cascade that failed part way touches several.
+func checkOrphanedRowsWithTx(user *User, tx *gorm.DB) ([]ConsistencyFinding, error) {
+	type deletedRow struct {
+		ID        int
+		DeletedAt time.Time
+	}
+
+	// Minute deleted to the tables rows were deleted from then
+	byMinute := make(map[time.Time]map[string][]int)
+	for _, step := range UserCascade {
+		if step.Table == "users" {
+			continue
+		}
+
+		var rows []deletedRow
+		err := tx.Scopes(OnlyDeleted).Table(step.Table).Where(step.Where, user.UserId).Select("id, deleted_at").Scan(&rows).Error
+		if err != nil && err != gorm.RecordNotFound {
+			return nil, fmt.Errorf("Error checking %v: %v", step.Table, err)
+		}
+		for _, row := range rows {
+			minute := row.DeletedAt.Truncate(time.Minute)
+			if byMinute[minute] == nil {
+				byMinute[minute] = make(map[string][]int)
+			}
+			byMinute[minute][step.Table] = append(byMinute[minute][step.Table], row.ID)
+		}
+	}
+
+	orphaned := make(map[string][]int)
+	for _, tables := range byMinute {
+		if len(tables) < 2 {
+			continue
+		}
+		for table, ids := range tables {
+			orphaned[table] = append(orphaned[table], ids...)
+		}
+	}
+
+	findings := make([]ConsistencyFinding, 0)
+	for _, step := range UserCascade {
+		if ids := orphaned[step.Table]; len(ids) > 0 {
+			sort.Ints(ids)
+			findings = append(findings, ConsistencyFinding{Category: InconsistentOrphanDeleted + step.Table, UserId: user.UserId, Table: step.Table, RowIds: ids})
+		}
+	}
+	return findings, nil
+}
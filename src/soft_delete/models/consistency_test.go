@@ -0,0 +1,102 @@
+package models
+
+import (
+	"soft_delete/driver/database"
+	"testing"
+	"time"
+)
+
+func TestCheckConsistency(t *testing.T) {
+	var user User
+
+	tx := database.App.Begin()
+	defer tx.Rollback()
+
+	err := tx.Joins("JOIN records ON records.user_id = users.user_id").First(&user).Error
+	if err != nil {
+		t.Fatal("Couldn't get a user with records: ", err)
+	}
+
+	// Delete only the users row, as a failed cascade would have
+	err = tx.Delete(&user).Error
+	if err != nil {
+		t.Fatal("Couldn't delete user: ", err)
+	}
+
+	findings, err := CheckConsistencyWithTx(tx)
+	if err != nil {
+		t.Fatal("Couldn't check consistency: ", err)
+	}
+	var mine []ConsistencyFinding
+	for _, finding := range findings {
+		if finding.UserId.String() == user.UserId.String() {
+			mine = append(mine, finding)
+		}
+	}
+	live := false
+	for _, finding := range mine {
+		live = live || finding.Category == InconsistentLivePrefix+"records"
+	}
+	if !live {
+		t.Fatalf("Expected live records to be found, got %+v", mine)
+	}
+
+	for _, finding := range mine {
+		err = finding.FixWithTx(tx)
+		if err != nil {
+			t.Fatal("Couldn't fix: ", err)
+		}
+	}
+
+	found, err := checkDeletedUserWithTx(&user, tx)
+	if err != nil {
+		t.Fatal("Couldn't check user: ", err)
+	}
+	if len(found) != 0 {
+		t.Fatalf("Expected no findings after fixing, got %+v", found)
+	}
+}
+
+func TestCheckOrphanedRows(t *testing.T) {
+	var user User
+
+	tx := database.App.Begin()
+	defer tx.Rollback()
+
+	err := tx.Joins("JOIN records ON records.user_id = users.user_id JOIN user_emails ON user_emails.user_id = users.user_id").
+		Where("NOT EXISTS (SELECT 1 FROM deletions WHERE deletions.user_id = users.user_id)").First(&user).Error
+	if err != nil {
+		t.Fatal("Couldn't get a user with records and emails: ", err)
+	}
+
+	// Delete records and emails but not the user, as a failed cascade would have
+	for _, table := range []string{"records", "user_emails"} {
+		err = tx.Table(table).Where("user_id = ?", user.UserId).UpdateColumn("deleted_at", time.Now()).Error
+		if err != nil {
+			t.Fatal("Couldn't delete ", table, ": ", err)
+		}
+	}
+
+	found, err := checkOrphanedRowsWithTx(&user, tx)
+	if err != nil {
+		t.Fatal("Couldn't check user: ", err)
+	}
+	if len(found) != 2 || !found[0].Undo() {
+		t.Fatalf("Expected orphaned emails and records to be undeleted, got %+v", found)
+	}
+
+	for _, finding := range found {
+		err = finding.FixWithTx(tx)
+		if err != nil {
+			t.Fatal("Couldn't fix: ", err)
+		}
+	}
+
+	found, err = checkOrphanedRowsWithTx(&user, tx)
+	if err != nil {
+		t.Fatal("Couldn't check user: ", err)
+	}
+	if len(found) != 0 {
+		t.Fatalf("Expected no findings after fixing, got %+v", found)
+	}
+}
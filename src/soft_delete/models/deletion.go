@@ -0,0 +1,474 @@
+package models
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/dabfleming/gorm"
+	"time"
+)
+
+// PendingDeletion statuses
+const (
+	PendingStatusPending   = "pending"
+	PendingStatusDone      = "done"
+	PendingStatusCancelled = "cancelled"
+	PendingStatusReplaced  = "replaced"
+)
+
+// UserState type and the states marking a user whose quit is scheduled or
+// done
+const (
+	StatusStateType   = "status"
+	StatusQuitPending = "quit_pending"
+	StatusQuit        = "quit"
+)
+
+// UserLog written when a user is offboarded
+const OffboardingLogName = "offboarding.quit"
+
+// One run of a deletion command, e.g. a single quit list.
+type DeletionBatch struct {
+	ID     int      `json:"id"`
+	Source string   `json:"source"`
+	Meta   Metadata `sql:"type:jsonb" json:"meta"`
+	Timestamps
+}
+
+// A quit held back until its effective date.
+type PendingDeletion struct {
+	ID            int       `json:"id"`
+	UserId        UUID      `sql:"type:uuid" json:"-"`
+	BatchId       int       `json:"batch_id"`
+	EffectiveDate time.Time `json:"effective_date"`
+	Status        string    `sql:"size:20" json:"status"`
+	Meta          Metadata  `sql:"type:jsonb" json:"meta"`
+	Timestamps
+}
+
+func NewDeletionBatch(source string, meta Metadata, tx *gorm.DB) (*DeletionBatch, error) {
+	batch := DeletionBatch{
+		Source: source,
+		Meta:   meta,
+	}
+	if batch.Meta == nil {
+		batch.Meta = Metadata{}
+	}
+	err := tx.Create(&batch).Error
+	if err != nil {
+		return nil, err
+	}
+	return &batch, nil
+}
+
+// Record why the user was quit in the batch's "reasons", keyed by user.
+// Merged in SQL so a row rolled back later leaves nothing behind.
+func (b *DeletionBatch) AddReasonWithTx(userId UUID, reason, notes string, tx *gorm.DB) error {
+	entry, err := json.Marshal(map[string]interface{}{
+		userId.String(): map[string]string{"reason": reason, "notes": notes},
+	})
+	if err != nil {
+		return err
+	}
+	return tx.Exec("UPDATE deletion_batches SET meta = COALESCE(meta, '{}'::jsonb) || jsonb_build_object('reasons', COALESCE(meta->'reasons', '{}'::jsonb) || ?::jsonb) WHERE id = ?", string(entry), b.ID).Error
+}
+
+// Returns the most recent batches, newest first.
+func DeletionBatchesWithTx(limit int, tx *gorm.DB) ([]DeletionBatch, error) {
+	var batches []DeletionBatch
+	err := tx.Order("id desc").Limit(limit).Find(&batches).Error
+	if err != nil && err != gorm.RecordNotFound {
+		return nil, err
+	}
+	return batches, nil
+}
+
+// Returns the user's current state of the given type, "" if none is set.
+func (u *User) StateWithTx(typeStr string, tx *gorm.DB) (string, error) {
+	var userState UserState
+	err := tx.Where("user_id = ? AND type = ?", u.UserId, typeStr).Order("id desc").First(&userState).Error
+	if err == gorm.RecordNotFound {
+		return "", nil
+	} else if err != nil {
+		return "", err
+	}
+	return userState.State, nil
+}
+
+// Record a pending deletion for the user and mark them quit_pending.
+// The previous status is kept so the deletion can be cancelled. A pending
+// deletion the user already has is replaced, and its previous status
+// carried over, so the user's status before either is what a cancel or
+// restore goes back to. Refused with a *LegalHoldError if the user is held.
+func (u *User) ScheduleDeletionWithTx(batchId int, effective time.Time, meta Metadata, tx *gorm.DB) (pending *PendingDeletion, replaced bool, err error) {
+	err = u.CheckLegalHoldWithTx(tx)
+	if err != nil {
+		return nil, false, err
+	}
+
+	previous, err := u.StateWithTx(StatusStateType, tx)
+	if err != nil {
+		return nil, false, err
+	}
+
+	var existing PendingDeletion
+	err = tx.Where("user_id = ? AND status = ?", u.UserId, PendingStatusPending).Order("id desc").First(&existing).Error
+	if err == nil {
+		replaced = true
+		if status, ok := existing.Meta["previous_status"].(string); ok {
+			previous = status
+		}
+		err = tx.Model(&PendingDeletion{}).Where("user_id = ? AND status = ?", u.UserId, PendingStatusPending).Update("status", PendingStatusReplaced).Error
+		if err != nil {
+			return nil, false, err
+		}
+	} else if err != gorm.RecordNotFound {
+		return nil, false, err
+	}
+
+	if meta == nil {
+		meta = Metadata{}
+	}
+	meta["previous_status"] = previous
+	if replaced {
+		meta["replaces"] = existing.ID
+	}
+
+	pending = &PendingDeletion{
+		UserId:        u.UserId,
+		BatchId:       batchId,
+		EffectiveDate: effective,
+		Status:        PendingStatusPending,
+		Meta:          meta,
+	}
+	err = tx.Create(pending).Error
+	if err != nil {
+		return nil, false, err
+	}
+
+	err = u.SetStateWithTx(StatusStateType, StatusQuitPending, tx)
+	if err != nil {
+		return nil, false, err
+	}
+
+	return pending, replaced, nil
+}
+
+// Log why the user is being offboarded and set their status to quit. The
+// status they had before is kept in the log, unless meta already carries
+// one. Returns both rows so the cascade can leave them as a trail.
+func (u *User) MarkQuitWithTx(meta Metadata, tx *gorm.DB) (CascadeKeep, error) {
+	previous, err := u.StateWithTx(StatusStateType, tx)
+	if err != nil {
+		return nil, err
+	}
+
+	if meta == nil {
+		meta = Metadata{}
+	}
+	if _, ok := meta["previous_status"]; !ok {
+		meta["previous_status"] = previous
+	}
+
+	state, err := u.SetStateReturningWithTx(StatusStateType, StatusQuit, tx)
+	if err != nil {
+		return nil, err
+	}
+
+	userLog, err := u.AddLogReturningWithTx(OffboardingLogName, "Offboarded", meta, tx)
+	if err != nil {
+		return nil, err
+	}
+
+	return CascadeKeep{"user_states": {state.ID}, "user_logs": {userLog.ID}}, nil
+}
+
+// Returns every pending deletion whose effective date has passed.
+func DuePendingDeletionsWithTx(now time.Time, tx *gorm.DB) ([]PendingDeletion, error) {
+	var due []PendingDeletion
+	err := tx.Where("status = ? AND effective_date <= ?", PendingStatusPending, now).Order("effective_date").Find(&due).Error
+	if err != nil && err != gorm.RecordNotFound {
+		return nil, err
+	}
+	return due, nil
+}
+
+// Mark every pending deletion of the user done. The caller is responsible
+// for the cascade itself.
+func (u *User) CompletePendingDeletionsWithTx(tx *gorm.DB) error {
+	return tx.Model(&PendingDeletion{}).Where("user_id = ? AND status = ?", u.UserId, PendingStatusPending).Update("status", PendingStatusDone).Error
+}
+
+// Cancel the deletion and put back the user's status from before it was
+// scheduled.
+func (p *PendingDeletion) CancelWithTx(tx *gorm.DB) error {
+	user := User{UserId: p.UserId}
+
+	p.Status = PendingStatusCancelled
+	err := tx.Save(p).Error
+	if err != nil {
+		return err
+	}
+
+	previous, _ := p.Meta["previous_status"].(string)
+	if previous != "" {
+		return user.SetStateWithTx(StatusStateType, previous, tx)
+	}
+	return tx.Where("user_id = ? AND type = ? AND state = ?", p.UserId, StatusStateType, StatusQuitPending).Delete(UserState{}).Error
+}
+
+// Deletion states
+const (
+	DeletionStateGrace    = "grace"
+	DeletionStateFinal    = "final"
+	DeletionStateRestored = "restored"
+	DeletionStatePurged   = "purged"
+)
+
+// A user's soft-delete, and the window the cascade ran in so exactly those
+// rows can later be restored or purged.
+type Deletion struct {
+	ID          int       `json:"id"`
+	UserId      UUID      `sql:"type:uuid" json:"-"`
+	BatchId     int       `json:"batch_id"`
+	State       string    `sql:"size:20" json:"state"`
+	StartedAt   time.Time `json:"started_at"`
+	FinishedAt  time.Time `json:"finished_at"`
+	GraceUntil  time.Time `json:"grace_until"`
+	FinalizedAt NullTime  `sql:"default:NULL" json:"finalized_at"`
+	Meta        Metadata  `sql:"type:jsonb" json:"meta"`
+	Timestamps
+}
+
+// Returned when deleting a user who is already soft deleted.
+var ErrAlreadyDeleted = errors.New("User is already deleted")
+
+// Soft delete the user, but for the rows in keep, and open a grace window
+// during which the deletion can be restored. The window bounds are rounded
+// out to whole seconds as deleted_at is stored with less precision than
+// time.Now(). Returns ErrAlreadyDeleted if the user is deleted already.
+func (u *User) GraceDeleteWithTx(batchId int, grace time.Duration, keep CascadeKeep, tx *gorm.DB) (*Deletion, error) {
+	var current User
+	err := tx.Scopes(WithDeleted).Where("user_id = ?", u.UserId).First(&current).Error
+	if err != nil {
+		return nil, err
+	}
+	if current.IsDeleted() {
+		return nil, ErrAlreadyDeleted
+	}
+
+	started := time.Now().Truncate(time.Second)
+
+	counts, err := u.SoftDeleteWithTx(keep, tx)
+	if err != nil {
+		return nil, err
+	}
+
+	finished := time.Now().Truncate(time.Second).Add(time.Second)
+	deletion := Deletion{
+		UserId:     u.UserId,
+		BatchId:    batchId,
+		State:      DeletionStateGrace,
+		StartedAt:  started,
+		FinishedAt: finished,
+		GraceUntil: finished.Add(grace),
+		Meta:       Metadata{"counts": counts.Metadata()},
+	}
+	err = tx.Create(&deletion).Error
+	if err != nil {
+		return nil, err
+	}
+	return &deletion, nil
+}
+
+// Merge meta into the deletion's Meta, in SQL as for AddReasonWithTx.
+func (d *Deletion) AddMetaWithTx(meta Metadata, tx *gorm.DB) error {
+	entry, err := json.Marshal(meta)
+	if err != nil {
+		return err
+	}
+	err = tx.Exec("UPDATE deletions SET meta = COALESCE(meta, '{}'::jsonb) || ?::jsonb WHERE id = ?", string(entry), d.ID).Error
+	if err != nil {
+		return err
+	}
+
+	if d.Meta == nil {
+		d.Meta = Metadata{}
+	}
+	for key, value := range meta {
+		d.Meta[key] = value
+	}
+	return nil
+}
+
+// Whether the quit asked for the user's research records to be retained
+// under a pseudonymous subject when the deletion is finalized.
+func (d *Deletion) RetainResearch() bool {
+	retain, _ := d.Meta["retain_research"].(bool)
+	return retain
+}
+
+// Rows soft-deleted per cascade table, as recorded at deletion time.
+func (d *Deletion) Counts() CascadeCounts {
+	counts := CascadeCounts{}
+	var recorded map[string]interface{}
+	switch meta := d.Meta["counts"].(type) {
+	case Metadata:
+		recorded = meta
+	case map[string]interface{}:
+		recorded = meta
+	}
+	for table, count := range recorded {
+		switch n := count.(type) {
+		case float64:
+			counts[table] = int64(n)
+		case int64:
+			counts[table] = n
+		case int:
+			counts[table] = int64(n)
+		}
+	}
+	return counts
+}
+
+// Returns the user's most recent deletion that is still in effect.
+func LatestDeletionWithTx(userId UUID, tx *gorm.DB) (*Deletion, error) {
+	var deletion Deletion
+	err := tx.Where("user_id = ? AND state IN (?, ?)", userId, DeletionStateGrace, DeletionStateFinal).Order("id desc").First(&deletion).Error
+	if err != nil {
+		return nil, err
+	}
+	return &deletion, nil
+}
+
+// Returns deletions in the given state, every state when state is "".
+func DeletionsWithTx(state string, tx *gorm.DB) ([]Deletion, error) {
+	var deletions []Deletion
+	query := tx.Order("id")
+	if state != "" {
+		query = query.Where("state = ?", state)
+	}
+	err := query.Find(&deletions).Error
+	if err != nil && err != gorm.RecordNotFound {
+		return nil, err
+	}
+	return deletions, nil
+}
+
+// Returns deletions whose grace window has closed.
+func DueDeletionsWithTx(now time.Time, tx *gorm.DB) ([]Deletion, error) {
+	var due []Deletion
+	err := tx.Where("state = ? AND grace_until <= ?", DeletionStateGrace, now).Order("grace_until").Find(&due).Error
+	if err != nil && err != gorm.RecordNotFound {
+		return nil, err
+	}
+	return due, nil
+}
+
+// Returns final deletions finalized before the given time.
+func PurgeableDeletionsWithTx(before time.Time, tx *gorm.DB) ([]Deletion, error) {
+	var purgeable []Deletion
+	err := tx.Where("state = ? AND finalized_at <= ?", DeletionStateFinal, before).Order("finalized_at").Find(&purgeable).Error
+	if err != nil && err != gorm.RecordNotFound {
+		return nil, err
+	}
+	return purgeable, nil
+}
+
+// Undelete every cascade row removed by this deletion, put back the status
+// the user had before they were marked quit and emit UserRestored.
+func (d *Deletion) RestoreWithTx(tx *gorm.DB) (CascadeCounts, error) {
+	counts := CascadeCounts{}
+	for _, step := range UserCascade {
+		rows, err := step.DeletedRowsWithTx(d.UserId, d.StartedAt, d.FinishedAt, tx)
+		if err != nil {
+			return nil, fmt.Errorf("Error finding deleted %v: %v", step.Table, err)
+		}
+		for _, row := range rows {
+			err = row.Restore(tx)
+			if err != nil {
+				return nil, fmt.Errorf("Error restoring %v: %v", step.Table, err)
+			}
+		}
+		counts[step.Table] = int64(len(rows))
+	}
+
+	user := User{UserId: d.UserId}
+	var offboarding UserLog
+	err := tx.Where("user_id = ? AND name = ?", d.UserId, OffboardingLogName).Order("id desc").First(&offboarding).Error
+	if err != nil && err != gorm.RecordNotFound {
+		return nil, err
+	}
+	previous, _ := offboarding.Meta["previous_status"].(string)
+	if previous != "" {
+		err = user.SetStateWithTx(StatusStateType, previous, tx)
+	} else {
+		err = tx.Where("user_id = ? AND type = ? AND state = ?", d.UserId, StatusStateType, StatusQuit).Delete(UserState{}).Error
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	err = EmitEventWithTx(EventUserRestored, d.UserId, Metadata{"deletion_id": d.ID, "counts": counts.Metadata()}, tx)
+	if err != nil {
+		return nil, err
+	}
+
+	d.State = DeletionStateRestored
+	return counts, tx.Save(d).Error
+}
+
+// Close the grace window: erase the user's PII, drop their sessions so
+// the deletion can't be quietly undone, and mark the deletion final.
+// Returns the number of fields erased and sessions dropped per table.
+func (d *Deletion) FinalizeWithTx(pointers []string, tx *gorm.DB) (CascadeCounts, error) {
+	user := User{UserId: d.UserId}
+	erased, err := user.EraseWithTx(pointers, tx)
+	if err != nil {
+		return nil, err
+	}
+
+	sessions := tx.Scopes(WithDeleted).Where("user_id = ?", d.UserId).Delete(&Session{})
+	if sessions.Error != nil {
+		return nil, fmt.Errorf("Error deleting sessions: %v", sessions.Error)
+	}
+
+	counts := erased.Counts()
+	counts["sessions"] = sessions.RowsAffected
+
+	if d.Meta == nil {
+		d.Meta = Metadata{}
+	}
+	d.Meta["erased"] = erased
+	d.State = DeletionStateFinal
+	d.FinalizedAt = NullTime{Time: time.Now(), Valid: true}
+	return counts, tx.Save(d).Error
+}
+
+// Hard delete every cascade row removed by this deletion. Refused with a
+// *LegalHoldError if the user is held.
+func (d *Deletion) PurgeWithTx(tx *gorm.DB) (CascadeCounts, error) {
+	user := User{UserId: d.UserId}
+	err := user.CheckLegalHoldWithTx(tx)
+	if err != nil {
+		return nil, err
+	}
+
+	counts := CascadeCounts{}
+	for _, step := range UserCascade {
+		rows, err := step.DeletedRowsWithTx(d.UserId, d.StartedAt, d.FinishedAt, tx)
+		if err != nil {
+			return nil, fmt.Errorf("Error finding deleted %v: %v", step.Table, err)
+		}
+		for _, row := range rows {
+			err = row.ForceDelete(tx)
+			if err != nil {
+				return nil, fmt.Errorf("Error purging %v: %v", step.Table, err)
+			}
+		}
+		counts[step.Table] = int64(len(rows))
+	}
+
+	d.State = DeletionStatePurged
+	return counts, tx.Save(d).Error
+}
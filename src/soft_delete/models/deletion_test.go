@@ -0,0 +1,193 @@
+package models
+
+import (
+	"soft_delete/driver/database"
+	"testing"
+	"time"
+)
+
+func TestScheduleAndCancelDeletion(t *testing.T) {
+	var user User
+
+	tx := database.App.Begin()
+	defer tx.Rollback()
+
+	err := tx.First(&user).Error
+	if err != nil {
+		t.Fatal("Couldn't get a user: ", err)
+	}
+
+	err = user.SetStateWithTx(StatusStateType, "active", tx)
+	if err != nil {
+		t.Fatal("Couldn't set state: ", err)
+	}
+
+	batch, err := NewDeletionBatch("deletion_test", nil, tx)
+	if err != nil {
+		t.Fatal("Couldn't create batch: ", err)
+	}
+
+	first, replaced, err := user.ScheduleDeletionWithTx(batch.ID, time.Now().AddDate(0, 0, 7), nil, tx)
+	if err != nil || replaced {
+		t.Fatalf("Couldn't schedule deletion (replaced: %v): %v", replaced, err)
+	}
+
+	pending, replaced, err := user.ScheduleDeletionWithTx(batch.ID, time.Now().AddDate(0, 0, 14), nil, tx)
+	if err != nil || !replaced {
+		t.Fatalf("Expected rescheduling to replace deletion %v (replaced: %v): %v", first.ID, replaced, err)
+	}
+	if pending.Meta["previous_status"] != "active" {
+		t.Fatalf("Expected previous status carried over, got %v", pending.Meta["previous_status"])
+	}
+
+	state, err := user.StateWithTx(StatusStateType, tx)
+	if err != nil || state != StatusQuitPending {
+		t.Fatalf("Expected state %v after scheduling, got %v (err: %v)", StatusQuitPending, state, err)
+	}
+
+	err = pending.CancelWithTx(tx)
+	if err != nil {
+		t.Fatal("Couldn't cancel deletion: ", err)
+	}
+
+	state, err = user.StateWithTx(StatusStateType, tx)
+	if err != nil || state != "active" {
+		t.Fatalf("Expected previous state restored after cancelling, got %v (err: %v)", state, err)
+	}
+}
+
+func TestGraceDeleteAndRestore(t *testing.T) {
+	var user, lookup User
+
+	tx := database.App.Begin()
+	defer tx.Rollback()
+
+	err := tx.First(&user).Error
+	if err != nil {
+		t.Fatal("Couldn't get a user: ", err)
+	}
+
+	deletion, err := user.GraceDeleteWithTx(0, time.Hour, nil, tx)
+	if err != nil {
+		t.Fatal("Couldn't delete user: ", err)
+	}
+	if deletion.State != DeletionStateGrace || !deletion.GraceUntil.After(time.Now()) {
+		t.Fatalf("Unexpected deletion after delete: %#v", deletion)
+	}
+
+	if !tx.Where("user_id = ?", user.UserId).First(&lookup).RecordNotFound() {
+		t.Fatal("User still visible after delete.")
+	}
+
+	latest, err := LatestDeletionWithTx(user.UserId, tx)
+	if err != nil || latest.ID != deletion.ID {
+		t.Fatalf("Latest deletion %#v does not match %#v (err: %v)", latest, deletion, err)
+	}
+
+	_, err = latest.RestoreWithTx(tx)
+	if err != nil {
+		t.Fatal("Couldn't restore user: ", err)
+	}
+
+	err = tx.Where("user_id = ?", user.UserId).First(&lookup).Error
+	if err != nil {
+		t.Fatal("User not visible after restore: ", err)
+	}
+}
+
+func TestMarkQuitSurvivesCascade(t *testing.T) {
+	var user User
+
+	tx := database.App.Begin()
+	defer tx.Rollback()
+
+	err := tx.First(&user).Error
+	if err != nil {
+		t.Fatal("Couldn't get a user: ", err)
+	}
+
+	err = user.SetStateWithTx(StatusStateType, "active", tx)
+	if err != nil {
+		t.Fatal("Couldn't set state: ", err)
+	}
+
+	keep, err := user.MarkQuitWithTx(Metadata{"source": "deletion_test"}, tx)
+	if err != nil {
+		t.Fatal("Couldn't mark user quit: ", err)
+	}
+
+	deletion, err := user.GraceDeleteWithTx(0, time.Hour, keep, tx)
+	if err != nil {
+		t.Fatal("Couldn't delete user: ", err)
+	}
+
+	state, err := user.StateWithTx(StatusStateType, tx)
+	if err != nil || state != StatusQuit {
+		t.Fatalf("Expected %v state to survive the cascade, got %v (err: %v)", StatusQuit, state, err)
+	}
+
+	var offboarding UserLog
+	err = tx.Where("user_id = ? AND name = ?", user.UserId, OffboardingLogName).First(&offboarding).Error
+	if err != nil {
+		t.Fatal("Offboarding log did not survive the cascade: ", err)
+	}
+
+	_, err = deletion.RestoreWithTx(tx)
+	if err != nil {
+		t.Fatal("Couldn't restore user: ", err)
+	}
+
+	state, err = user.StateWithTx(StatusStateType, tx)
+	if err != nil || state != "active" {
+		t.Fatalf("Expected previous state back after restore, got %v (err: %v)", state, err)
+	}
+}
+
+func TestBatchReasons(t *testing.T) {
+	var user User
+
+	tx := database.App.Begin()
+	defer tx.Rollback()
+
+	err := tx.First(&user).Error
+	if err != nil {
+		t.Fatal("Couldn't get a user: ", err)
+	}
+
+	batch, err := NewDeletionBatch("deletion_test", nil, tx)
+	if err != nil {
+		t.Fatal("Couldn't create batch: ", err)
+	}
+
+	err = batch.AddReasonWithTx(user.UserId, "voluntary", "moved away", tx)
+	if err != nil {
+		t.Fatal("Couldn't add reason: ", err)
+	}
+
+	var reloaded DeletionBatch
+	err = tx.Where("id = ?", batch.ID).First(&reloaded).Error
+	if err != nil {
+		t.Fatal("Couldn't reload batch: ", err)
+	}
+
+	reasons, _ := reloaded.Meta["reasons"].(map[string]interface{})
+	entry, _ := reasons[user.UserId.String()].(map[string]interface{})
+	if entry["reason"] != "voluntary" || entry["notes"] != "moved away" {
+		t.Fatalf("Unexpected batch reasons: %#v", reloaded.Meta)
+	}
+}
+
+func TestDeletionCountsBeforeReload(t *testing.T) {
+	counts := CascadeCounts{"users": 1, "records": 12}
+	deletion := Deletion{Meta: Metadata{"counts": counts.Metadata()}}
+
+	got := deletion.Counts()
+	if got["users"] != 1 || got["records"] != 12 {
+		t.Fatalf("Expected %v from a fresh deletion, got %v", counts, got)
+	}
+
+	reloaded := Deletion{Meta: Metadata{"counts": map[string]interface{}{"users": float64(1)}}}
+	if reloaded.Counts()["users"] != 1 {
+		t.Fatalf("Expected counts from a reloaded deletion, got %v", reloaded.Counts())
+	}
+}
@@ -0,0 +1,202 @@
+package models
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"github.com/dabfleming/gorm"
+	"sort"
+	"strings"
+)
+
+// Prefix of every token written over erased PII
+const ErasedPrefix = "erased-"
+
+// Table name to the fields scrubbed in it.
+type ErasureResult map[string][]string
+
+func (r ErasureResult) add(table, field string) {
+	for _, f := range r[table] {
+		if f == field {
+			return
+		}
+	}
+	r[table] = append(r[table], field)
+	sort.Strings(r[table])
+}
+
+// Tables in r, sorted.
+func (r ErasureResult) Tables() []string {
+	tables := make([]string, 0, len(r))
+	for table := range r {
+		tables = append(tables, table)
+	}
+	sort.Strings(tables)
+	return tables
+}
+
+// Number of fields scrubbed in each table.
+func (r ErasureResult) Counts() CascadeCounts {
+	counts := CascadeCounts{}
+	for table, fields := range r {
+		counts[table] = int64(len(fields))
+	}
+	return counts
+}
+
+// Returns a random token to write over a PII value. It is not derived
+// from the value, so nothing can be recovered from it.
+func ErasureToken() string {
+	b := make([]byte, 12)
+	rand.Read(b)
+	return ErasedPrefix + hex.EncodeToString(b)
+}
+
+// Replace the value at each JSON pointer in meta with a token. Returns the
+// pointers that were present.
+func EraseMeta(meta Metadata, pointers []string) []string {
+	erased := make([]string, 0)
+	for _, pointer := range pointers {
+		if eraseMetaPointer(meta, pointer) {
+			erased = append(erased, pointer)
+		}
+	}
+	return erased
+}
+
+func eraseMetaPointer(meta map[string]interface{}, pointer string) bool {
+	if meta == nil || !strings.HasPrefix(pointer, "/") {
+		return false
+	}
+
+	parts := strings.Split(pointer[1:], "/")
+	for i, part := range parts {
+		key := strings.Replace(strings.Replace(part, "~1", "/", -1), "~0", "~", -1)
+		value, ok := meta[key]
+		if !ok {
+			return false
+		}
+		if i == len(parts)-1 {
+			if value == nil {
+				return false
+			}
+			meta[key] = ErasureToken()
+			return true
+		}
+		meta, ok = value.(map[string]interface{})
+		if !ok {
+			return false
+		}
+	}
+	return false
+}
+
+// Replace the user's PII with irreversible tokens, keeping every row so
+// aggregates still add up. Deleted rows are erased too. pointers are JSON
+// pointers into the Meta of the user, their addresses and their records.
+// Refused with a *LegalHoldError if the user is held.
+func (u *User) EraseWithTx(pointers []string, tx *gorm.DB) (ErasureResult, error) {
+	err := u.CheckLegalHoldWithTx(tx)
+	if err != nil {
+		return nil, err
+	}
+
+	result := ErasureResult{}
+	db := tx.Scopes(WithDeleted)
+
+	var users []User
+	err = db.Where("user_id = ?", u.UserId).Find(&users).Error
+	if err != nil && err != gorm.RecordNotFound {
+		return nil, err
+	}
+	for _, user := range users {
+		columns := map[string]interface{}{
+			"display_name": ErasureToken(),
+			"password":     nil,
+		}
+		result.add("users", "display_name")
+		result.add("users", "password")
+		for _, pointer := range EraseMeta(user.Meta, pointers) {
+			columns["meta"] = user.Meta
+			result.add("users", "meta"+pointer)
+		}
+		err = db.Table("users").Where("id = ?", user.ID).UpdateColumns(columns).Error
+		if err != nil {
+			return nil, fmt.Errorf("Error erasing users: %v", err)
+		}
+	}
+
+	var emails []UserEmail
+	err = db.Where("user_id = ?", u.UserId).Find(&emails).Error
+	if err != nil && err != gorm.RecordNotFound {
+		return nil, err
+	}
+	for _, email := range emails {
+		err = db.Table("user_emails").Where("id = ?", email.ID).UpdateColumns(map[string]interface{}{
+			"email":    ErasureToken() + "@erased.invalid",
+			"verified": false,
+		}).Error
+		if err != nil {
+			return nil, fmt.Errorf("Error erasing user_emails: %v", err)
+		}
+		result.add("user_emails", "email")
+	}
+
+	var addresses []UserAddress
+	err = db.Where("user_id = ?", u.UserId).Find(&addresses).Error
+	if err != nil && err != gorm.RecordNotFound {
+		return nil, err
+	}
+	for _, address := range addresses {
+		// State and country are kept for regional aggregates. Zipcode and
+		// plus4 are too short for a token and are blanked instead.
+		columns := map[string]interface{}{
+			"name":          ErasureToken(),
+			"address_line1": ErasureToken(),
+			"address_line2": ErasureToken(),
+			"city":          ErasureToken(),
+			"zipcode":       "",
+			"plus4":         "",
+		}
+		for field := range columns {
+			result.add("user_addresses", field)
+		}
+		for _, pointer := range EraseMeta(address.Meta, pointers) {
+			columns["meta"] = address.Meta
+			result.add("user_addresses", "meta"+pointer)
+		}
+		err = db.Table("user_addresses").Where("id = ?", address.ID).UpdateColumns(columns).Error
+		if err != nil {
+			return nil, fmt.Errorf("Error erasing user_addresses: %v", err)
+		}
+	}
+
+	var records []Record
+	err = db.Where("user_id = ?", u.UserId).Find(&records).Error
+	if err != nil && err != gorm.RecordNotFound {
+		return nil, err
+	}
+	for _, record := range records {
+		erased := EraseMeta(record.Meta, pointers)
+		if len(erased) == 0 {
+			continue
+		}
+		err = db.Table("records").Where("id = ?", record.ID).UpdateColumn("meta", record.Meta).Error
+		if err != nil {
+			return nil, fmt.Errorf("Error erasing records: %v", err)
+		}
+		for _, pointer := range erased {
+			result.add("records", "meta"+pointer)
+		}
+	}
+
+	assets := db.Table("user_assets").Where("user_id = ?", u.UserId).UpdateColumn("data", nil)
+	if assets.Error != nil {
+		return nil, fmt.Errorf("Error erasing user_assets: %v", assets.Error)
+	}
+	if assets.RowsAffected > 0 {
+		result.add("user_assets", "data")
+	}
+
+	return result, nil
+}
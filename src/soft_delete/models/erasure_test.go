@@ -0,0 +1,39 @@
+package models
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestEraseMeta(t *testing.T) {
+	meta := Metadata{
+		"first_name": "Ada",
+		"avatar":     map[string]interface{}{"data": "data:image/png;base64,AAAA"},
+		"a/b":        "escaped",
+		"weight":     70,
+	}
+
+	erased := EraseMeta(meta, []string{"/first_name", "/avatar/data", "/a~1b", "/missing", "/avatar/missing"})
+	if len(erased) != 3 {
+		t.Fatalf("Expected 3 pointers erased, got %v", erased)
+	}
+
+	if !strings.HasPrefix(meta["first_name"].(string), ErasedPrefix) {
+		t.Errorf("first_name not erased: %v", meta["first_name"])
+	}
+	if !strings.HasPrefix(meta["avatar"].(map[string]interface{})["data"].(string), ErasedPrefix) {
+		t.Errorf("avatar/data not erased: %v", meta["avatar"])
+	}
+	if !strings.HasPrefix(meta["a/b"].(string), ErasedPrefix) {
+		t.Errorf("a/b not erased: %v", meta["a/b"])
+	}
+	if meta["weight"] != 70 {
+		t.Errorf("weight should be untouched: %v", meta["weight"])
+	}
+}
+
+func TestErasureTokensDiffer(t *testing.T) {
+	if ErasureToken() == ErasureToken() {
+		t.Fatal("Erasure tokens repeat.")
+	}
+}
@@ -0,0 +1,92 @@
+package models
+
+import (
+	"github.com/dabfleming/gorm"
+	"time"
+)
+
+// HREvent statuses
+const (
+	HREventReceived   = "received"
+	HREventProcessing = "processing"
+	HREventProcessed  = "processed"
+	HREventFailed     = "failed"
+)
+
+// A quit event pushed by an employer's HR system. Events are stored as
+// received, signature verified, and processed afterwards so they can be
+// replayed. EventId is the employer's own ID for the event, unique per
+// employer, so a resent event is only stored once.
+type HREvent struct {
+	ID          int      `json:"id"`
+	EmployerKey string   `sql:"size:100" json:"employer_key"`
+	EventId     string   `sql:"size:100" json:"event_id"`
+	Payload     Metadata `sql:"type:jsonb" json:"payload"`
+	Status      string   `sql:"size:20" json:"status"`
+	Attempts    int      `json:"attempts"`
+	Outcome     string   `sql:"size:50" json:"outcome"`
+	Message     string   `json:"message"`
+	ProcessedAt NullTime `sql:"default:NULL" json:"processed_at"`
+	Timestamps
+}
+
+func NewHREventWithTx(employerKey, eventId string, payload Metadata, tx *gorm.DB) (*HREvent, error) {
+	event := HREvent{
+		EmployerKey: employerKey,
+		EventId:     eventId,
+		Payload:     payload,
+		Status:      HREventReceived,
+	}
+	err := tx.Create(&event).Error
+	if err != nil {
+		return nil, err
+	}
+	return &event, nil
+}
+
+// Returns the employer's event with the given event ID.
+func HREventByEventIdWithTx(employerKey, eventId string, tx *gorm.DB) (*HREvent, error) {
+	var event HREvent
+	err := tx.Where("employer_key = ? AND event_id = ?", employerKey, eventId).First(&event).Error
+	if err != nil {
+		return nil, err
+	}
+	return &event, nil
+}
+
+// Claim up to limit events waiting to be processed, oldest first, marking
+// them processing. Events left processing longer than stale, by a process
+// that died, are claimed again. Concurrent processors skip each other's
+// claims, as for ClaimJobWithTx.
+func ClaimHREventsWithTx(limit int, stale time.Duration, tx *gorm.DB) ([]HREvent, error) {
+	var events []HREvent
+	err := tx.Raw(`UPDATE hr_events SET status = ?, updated_at = now()
+		WHERE id IN (
+			SELECT id FROM hr_events
+			WHERE status = ? OR (status = ? AND updated_at < ?)
+			ORDER BY id
+			FOR UPDATE SKIP LOCKED
+			LIMIT ?
+		)
+		RETURNING *`, HREventProcessing, HREventReceived, HREventProcessing, time.Now().Add(-stale), limit).Scan(&events).Error
+	if err != nil && err != gorm.RecordNotFound {
+		return nil, err
+	}
+	return events, nil
+}
+
+// Record the result of processing the event.
+func (e *HREvent) FinishWithTx(status, outcome, message string, tx *gorm.DB) error {
+	e.Status = status
+	e.Attempts++
+	e.Outcome = outcome
+	e.Message = message
+	e.ProcessedAt = NullTime{Time: time.Now(), Valid: true}
+	return tx.Save(e).Error
+}
+
+// Queue the event to be processed again.
+func (e *HREvent) ReplayWithTx(tx *gorm.DB) error {
+	e.Status = HREventReceived
+	return tx.Save(e).Error
+}
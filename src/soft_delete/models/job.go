@@ -0,0 +1,118 @@
+package models
+
+import (
+	"github.com/dabfleming/gorm"
+	"time"
+)
+
+// Job statuses. Dead jobs ran out of attempts and wait for someone to
+// retry or cancel them.
+const (
+	JobPending   = "pending"
+	JobRunning   = "running"
+	JobDone      = "done"
+	JobDead      = "dead"
+	JobCancelled = "cancelled"
+)
+
+// A side effect of a committed change, run by the job worker so it can
+// fail and be retried independently of the transaction that queued it.
+type Job struct {
+	ID        int       `json:"id"`
+	Type      string    `sql:"size:50" json:"type"`
+	Payload   Metadata  `sql:"type:jsonb" json:"payload"`
+	Status    string    `sql:"size:20" json:"status"`
+	Attempts  int       `json:"attempts"`
+	NextRunAt time.Time `json:"next_run_at"`
+	LockedAt  NullTime  `sql:"default:NULL" json:"locked_at"`
+	LastError string    `json:"last_error"`
+	Timestamps
+}
+
+// Queue a job within tx, to run once tx commits.
+func EnqueueJobWithTx(jobType string, payload Metadata, tx *gorm.DB) (*Job, error) {
+	if payload == nil {
+		payload = Metadata{}
+	}
+	job := Job{
+		Type:      jobType,
+		Payload:   payload,
+		Status:    JobPending,
+		NextRunAt: time.Now(),
+	}
+	err := tx.Create(&job).Error
+	if err != nil {
+		return nil, err
+	}
+	return &job, nil
+}
+
+// Claim the oldest due job for this worker, nil if there is none. Jobs
+// left running longer than stale, by a worker that died, are claimed
+// again. Concurrent workers skip each other's claims.
+func ClaimJobWithTx(stale time.Duration, tx *gorm.DB) (*Job, error) {
+	var jobs []Job
+	err := tx.Raw(`UPDATE jobs SET status = ?, locked_at = now(), updated_at = now()
+		WHERE id = (
+			SELECT id FROM jobs
+			WHERE (status = ? AND next_run_at <= now()) OR (status = ? AND locked_at < ?)
+			ORDER BY id
+			FOR UPDATE SKIP LOCKED
+			LIMIT 1
+		)
+		RETURNING *`, JobRunning, JobPending, JobRunning, time.Now().Add(-stale)).Scan(&jobs).Error
+	if err == gorm.RecordNotFound || (err == nil && len(jobs) == 0) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	return &jobs[0], nil
+}
+
+// Returns jobs in the given status, every status when status is "".
+func JobsWithTx(status string, tx *gorm.DB) ([]Job, error) {
+	var jobs []Job
+	query := tx.Order("id")
+	if status != "" {
+		query = query.Where("status = ?", status)
+	}
+	err := query.Find(&jobs).Error
+	if err != nil && err != gorm.RecordNotFound {
+		return nil, err
+	}
+	return jobs, nil
+}
+
+func (j *Job) SucceedWithTx(tx *gorm.DB) error {
+	j.Attempts++
+	j.Status = JobDone
+	j.LastError = ""
+	return tx.Save(j).Error
+}
+
+// Record a failed attempt. The job runs again at retryAt, or is dead if
+// retryAt is zero.
+func (j *Job) FailWithTx(cause error, retryAt time.Time, tx *gorm.DB) error {
+	j.Attempts++
+	j.LastError = cause.Error()
+	if retryAt.IsZero() {
+		j.Status = JobDead
+	} else {
+		j.Status = JobPending
+		j.NextRunAt = retryAt
+	}
+	return tx.Save(j).Error
+}
+
+// Queue the job to run now with a fresh set of attempts.
+func (j *Job) RetryWithTx(tx *gorm.DB) error {
+	j.Status = JobPending
+	j.Attempts = 0
+	j.NextRunAt = time.Now()
+	return tx.Save(j).Error
+}
+
+func (j *Job) CancelWithTx(tx *gorm.DB) error {
+	j.Status = JobCancelled
+	return tx.Save(j).Error
+}
@@ -0,0 +1,42 @@
+package models
+
+import (
+	"errors"
+	"soft_delete/driver/database"
+	"testing"
+	"time"
+)
+
+func TestJobLifecycle(t *testing.T) {
+	tx := database.App.Begin()
+	defer tx.Rollback()
+
+	job, err := EnqueueJobWithTx("job_test", Metadata{"n": 1}, tx)
+	if err != nil {
+		t.Fatal("Couldn't enqueue job: ", err)
+	}
+
+	claimed, err := ClaimJobWithTx(time.Hour, tx)
+	if err != nil {
+		t.Fatal("Couldn't claim job: ", err)
+	}
+	if claimed == nil || claimed.ID != job.ID || claimed.Status != JobRunning {
+		t.Fatalf("Expected to claim job %v, got %+v", job.ID, claimed)
+	}
+
+	err = claimed.FailWithTx(errors.New("down"), time.Time{}, tx)
+	if err != nil {
+		t.Fatal("Couldn't fail job: ", err)
+	}
+	if claimed.Status != JobDead || claimed.Attempts != 1 {
+		t.Fatalf("Expected a dead job after 1 attempt, got %v after %v", claimed.Status, claimed.Attempts)
+	}
+
+	err = claimed.RetryWithTx(tx)
+	if err != nil {
+		t.Fatal("Couldn't retry job: ", err)
+	}
+	if claimed.Status != JobPending || claimed.Attempts != 0 {
+		t.Fatalf("Expected a pending job with no attempts, got %v with %v", claimed.Status, claimed.Attempts)
+	}
+}
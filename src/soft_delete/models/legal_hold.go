@@ -0,0 +1,105 @@
+package models
+
+import (
+	"fmt"
+	"github.com/dabfleming/gorm"
+	"time"
+)
+
+// A hold on a user's data while it may be needed in a dispute. Held users
+// can't be deleted, erased or purged until the hold is released or expires.
+type LegalHold struct {
+	ID         int      `json:"id"`
+	UserId     UUID     `sql:"type:uuid" json:"-"`
+	Reason     string   `json:"reason"`
+	CreatedBy  string   `sql:"size:100" json:"created_by"`
+	ExpiresAt  NullTime `sql:"default:NULL" json:"expires_at"`
+	ReleasedAt NullTime `sql:"default:NULL" json:"released_at"`
+	ReleasedBy string   `sql:"size:100" json:"released_by"`
+	Timestamps
+}
+
+// Returned when an operation is refused because the user is held.
+type LegalHoldError struct {
+	Hold LegalHold
+}
+
+func (e *LegalHoldError) Error() string {
+	return fmt.Sprintf("User %v is under legal hold %v (%v, placed by %v)", e.Hold.UserId, e.Hold.ID, e.Hold.Reason, e.Hold.CreatedBy)
+}
+
+// Whether err is a refusal because of a legal hold.
+func IsLegalHold(err error) bool {
+	_, ok := err.(*LegalHoldError)
+	return ok
+}
+
+// Place a hold on the user and log it. A zero expires never expires.
+func (u *User) PlaceLegalHoldWithTx(reason, createdBy string, expires time.Time, tx *gorm.DB) (*LegalHold, error) {
+	hold := LegalHold{
+		UserId:    u.UserId,
+		Reason:    reason,
+		CreatedBy: createdBy,
+		ExpiresAt: NullTime{Time: expires, Valid: !expires.IsZero()},
+	}
+	err := tx.Create(&hold).Error
+	if err != nil {
+		return nil, err
+	}
+
+	meta := Metadata{"hold_id": hold.ID, "reason": reason, "created_by": createdBy}
+	if !expires.IsZero() {
+		meta["expires_at"] = expires
+	}
+	err = u.AddLogWithTx("legal_hold.placed", "Legal hold placed: "+reason, meta, tx)
+	if err != nil {
+		return nil, err
+	}
+	return &hold, nil
+}
+
+// Release the hold and log it on the held user.
+func (h *LegalHold) ReleaseWithTx(releasedBy string, tx *gorm.DB) error {
+	h.ReleasedAt = NullTime{Time: time.Now(), Valid: true}
+	h.ReleasedBy = releasedBy
+	err := tx.Save(h).Error
+	if err != nil {
+		return err
+	}
+
+	user := User{UserId: h.UserId}
+	meta := Metadata{"hold_id": h.ID, "released_by": releasedBy}
+	return user.AddLogWithTx("legal_hold.released", "Legal hold released", meta, tx)
+}
+
+// Returns the user's active holds.
+func (u *User) LegalHoldsWithTx(tx *gorm.DB) ([]LegalHold, error) {
+	var holds []LegalHold
+	err := tx.Where("user_id = ? AND released_at IS NULL AND (expires_at IS NULL OR expires_at > ?)", u.UserId, time.Now()).Order("id").Find(&holds).Error
+	if err != nil && err != gorm.RecordNotFound {
+		return nil, err
+	}
+	return holds, nil
+}
+
+// Returns a *LegalHoldError if the user has an active hold, nil otherwise.
+func (u *User) CheckLegalHoldWithTx(tx *gorm.DB) error {
+	holds, err := u.LegalHoldsWithTx(tx)
+	if err != nil {
+		return err
+	}
+	if len(holds) > 0 {
+		return &LegalHoldError{Hold: holds[0]}
+	}
+	return nil
+}
+
+// Returns every active hold.
+func ActiveLegalHoldsWithTx(tx *gorm.DB) ([]LegalHold, error) {
+	var holds []LegalHold
+	err := tx.Where("released_at IS NULL AND (expires_at IS NULL OR expires_at > ?)", time.Now()).Order("id").Find(&holds).Error
+	if err != nil && err != gorm.RecordNotFound {
+		return nil, err
+	}
+	return holds, nil
+}
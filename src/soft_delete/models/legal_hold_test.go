@@ -0,0 +1,81 @@
+package models
+
+import (
+	"soft_delete/driver/database"
+	"testing"
+	"time"
+)
+
+func TestLegalHoldBlocksDeletion(t *testing.T) {
+	var user User
+
+	tx := database.App.Begin()
+	defer tx.Rollback()
+
+	err := tx.First(&user).Error
+	if err != nil {
+		t.Fatal("Couldn't get a user: ", err)
+	}
+
+	hold, err := user.PlaceLegalHoldWithTx("test dispute", "legal_hold_test", time.Time{}, tx)
+	if err != nil {
+		t.Fatal("Couldn't place hold: ", err)
+	}
+
+	_, err = user.SoftDeleteWithTx(nil, tx)
+	if !IsLegalHold(err) {
+		t.Fatalf("Expected legal hold error deleting held user, got %v", err)
+	}
+
+	_, err = user.EraseWithTx(nil, tx)
+	if !IsLegalHold(err) {
+		t.Fatalf("Expected legal hold error erasing held user, got %v", err)
+	}
+
+	err = hold.ReleaseWithTx("legal_hold_test", tx)
+	if err != nil {
+		t.Fatal("Couldn't release hold: ", err)
+	}
+
+	err = user.CheckLegalHoldWithTx(tx)
+	if err != nil {
+		t.Fatal("User still held after release: ", err)
+	}
+}
+
+func TestLegalHoldSaveKeepsNoExpiry(t *testing.T) {
+	var user User
+	var lookup LegalHold
+
+	tx := database.App.Begin()
+	defer tx.Rollback()
+
+	err := tx.First(&user).Error
+	if err != nil {
+		t.Fatal("Couldn't get a user: ", err)
+	}
+
+	hold, err := user.PlaceLegalHoldWithTx("test dispute", "legal_hold_test", time.Time{}, tx)
+	if err != nil {
+		t.Fatal("Couldn't place hold: ", err)
+	}
+
+	// A Save of the whole hold mustn't turn "never expires" into a date
+	err = tx.Save(hold).Error
+	if err != nil {
+		t.Fatal("Couldn't save hold: ", err)
+	}
+	err = user.CheckLegalHoldWithTx(tx)
+	if !IsLegalHold(err) {
+		t.Fatalf("Expected hold still active after save, got %v", err)
+	}
+
+	err = hold.ReleaseWithTx("legal_hold_test", tx)
+	if err != nil {
+		t.Fatal("Couldn't release hold: ", err)
+	}
+	err = tx.Where("id = ?", hold.ID).First(&lookup).Error
+	if err != nil || lookup.ExpiresAt.Valid || !lookup.ReleasedAt.Valid {
+		t.Fatalf("Expected released hold without an expiry, got %#v (err: %v)", lookup, err)
+	}
+}
@@ -177,9 +177,9 @@ type Timestamps struct {
 	UpdatedAt time.Time `sql:"NOT NULL" json:"date_updated"`
 }
 
-// Embedded in other structs to add DeletedAt
+// Embedded in other structs to add DeletedAt, see soft_delete.go
 type SoftDelete struct {
-	DeletedAt time.Time `sql:"default:NULL" json:"-"`
+	DeletedAt NullTime `sql:"default:NULL" json:"-"`
 }
 
 type Entity struct {
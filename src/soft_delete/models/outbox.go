@@ -0,0 +1,84 @@
+package models
+
+import (
+	"github.com/dabfleming/gorm"
+	"time"
+)
+
+// Domain event types
+const (
+	EventUserSoftDeleted = "UserSoftDeleted"
+	EventUserRestored    = "UserRestored"
+	EventRecordDeleted   = "RecordDeleted"
+)
+
+// OutboxEvent statuses
+const (
+	OutboxStatusPending   = "pending"
+	OutboxStatusDelivered = "delivered"
+	OutboxStatusFailed    = "failed"
+)
+
+// A domain event waiting in the outbox. Events are written in the same
+// transaction as the change they describe and delivered afterwards by the
+// dispatcher, at least once.
+type OutboxEvent struct {
+	ID            int       `json:"id"`
+	Type          string    `sql:"size:50" json:"type"`
+	UserId        UUID      `sql:"type:uuid" json:"-"`
+	Payload       Metadata  `sql:"type:jsonb" json:"payload"`
+	Status        string    `sql:"size:20" json:"status"`
+	Attempts      int       `json:"attempts"`
+	NextAttemptAt time.Time `json:"next_attempt_at"`
+	DeliveredAt   NullTime  `sql:"default:NULL" json:"delivered_at"`
+	LastError     string    `json:"last_error"`
+	Timestamps
+}
+
+// Write an event to the outbox within tx.
+func EmitEventWithTx(eventType string, userId UUID, payload Metadata, tx *gorm.DB) error {
+	if payload == nil {
+		payload = Metadata{}
+	}
+	payload["user_id"] = userId.String()
+
+	event := OutboxEvent{
+		Type:          eventType,
+		UserId:        userId,
+		Payload:       payload,
+		Status:        OutboxStatusPending,
+		NextAttemptAt: time.Now(),
+	}
+	return tx.Create(&event).Error
+}
+
+// Returns up to limit pending events due for an attempt, oldest first.
+func DueEventsWithTx(now time.Time, limit int, tx *gorm.DB) ([]OutboxEvent, error) {
+	var events []OutboxEvent
+	err := tx.Where("status = ? AND next_attempt_at <= ?", OutboxStatusPending, now).Order("id").Limit(limit).Find(&events).Error
+	if err != nil && err != gorm.RecordNotFound {
+		return nil, err
+	}
+	return events, nil
+}
+
+func (e *OutboxEvent) MarkDeliveredWithTx(tx *gorm.DB) error {
+	e.Status = OutboxStatusDelivered
+	e.Attempts++
+	e.DeliveredAt = NullTime{Time: time.Now(), Valid: true}
+	e.LastError = ""
+	return tx.Save(e).Error
+}
+
+// Record a failed attempt. The event is retried at retryAt, or given up on
+// if retryAt is zero.
+func (e *OutboxEvent) MarkFailedWithTx(cause error, retryAt time.Time, tx *gorm.DB) error {
+	e.Attempts++
+	e.LastError = cause.Error()
+	if retryAt.IsZero() {
+		e.Status = OutboxStatusFailed
+	} else {
+		e.NextAttemptAt = retryAt
+	}
+	return tx.Save(e).Error
+}
@@ -2,6 +2,7 @@ package models
 
 import (
 	"fmt"
+	"github.com/dabfleming/gorm"
 	"soft_delete/driver/database"
 	"time"
 )
@@ -224,3 +225,51 @@ func (r *Record) Save() error {
 
 	return nil
 }
+
+// Returns midnight UTC on the Monday of t's week.
+func WeekOf(t time.Time) time.Time {
+	day := t.UTC().Truncate(24 * time.Hour)
+	offset := (int(day.Weekday()) + 6) % 7
+	return day.AddDate(0, 0, -offset)
+}
+
+// Move the records of the named entities that this deletion soft deleted
+// to a pseudonymous subject, live again, keeping only the allowed top level
+// Meta keys. RecordAt is coarsened to the week, and CreatedAt and UpdatedAt
+// are set to that week too so neither links the subject back to the user.
+// Returns the number of records moved.
+func (d *Deletion) PseudonymizeRecordsWithTx(subject UUID, entities, allowedMeta []string, tx *gorm.DB) (int, error) {
+	if len(entities) == 0 {
+		return 0, nil
+	}
+
+	var records []Record
+	err := tx.Scopes(DeletedBetween(d.StartedAt, d.FinishedAt)).Where("user_id = ? AND entity_id in (SELECT id from entities where name in (?))", d.UserId, entities).Find(&records).Error
+	if err != nil && err != gorm.RecordNotFound {
+		return 0, err
+	}
+
+	for _, record := range records {
+		meta := Metadata{}
+		for _, key := range allowedMeta {
+			if value, ok := record.Meta[key]; ok {
+				meta[key] = value
+			}
+		}
+
+		week := WeekOf(record.RecordAt)
+		err = tx.Table("records").Where("id = ?", record.ID).UpdateColumns(map[string]interface{}{
+			"user_id":    subject,
+			"meta":       meta,
+			"record_at":  week,
+			"created_at": week,
+			"updated_at": week,
+			"deleted_at": nil,
+		}).Error
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	return len(records), nil
+}
@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"soft_delete/driver/database"
 	"testing"
+	"time"
 )
 
 func TestRecordHelperMethods(t *testing.T) {
@@ -150,3 +151,72 @@ func TestRecordHelperMethods(t *testing.T) {
 	}
 	t.Logf("Record after save:\n%v", string(json))
 }
+
+func TestWeekOf(t *testing.T) {
+	// Thursday
+	thursday := time.Date(2015, time.June, 11, 17, 30, 0, 0, time.UTC)
+	week := WeekOf(thursday)
+
+	if week.Weekday() != time.Monday || week.Day() != 8 || week.Hour() != 0 {
+		t.Fatalf("Expected Monday June 8 00:00 UTC, got %v", week)
+	}
+	if !WeekOf(week).Equal(week) {
+		t.Fatalf("WeekOf a Monday should be itself, got %v", WeekOf(week))
+	}
+
+	sunday := time.Date(2015, time.June, 14, 23, 0, 0, 0, time.UTC)
+	if !WeekOf(sunday).Equal(week) {
+		t.Fatalf("Sunday should belong to the preceding Monday's week, got %v", WeekOf(sunday))
+	}
+}
+
+func TestPseudonymizeRecordsWithoutEntities(t *testing.T) {
+	var deletion Deletion
+
+	// No entities configured, so no query is run and tx isn't needed
+	moved, err := deletion.PseudonymizeRecordsWithTx(UUID{}, nil, nil, nil)
+	if err != nil || moved != 0 {
+		t.Fatalf("Expected nothing moved, got %v (err: %v)", moved, err)
+	}
+}
+
+func TestPseudonymizeRecordsAfterGraceDelete(t *testing.T) {
+	var user User
+	var entity Entity
+
+	tx := database.App.Begin()
+	defer tx.Rollback()
+
+	err := tx.Where("user_id IN (SELECT user_id FROM records)").First(&user).Error
+	if err != nil {
+		t.Fatal("Couldn't get a user with records: ", err)
+	}
+	err = tx.Where("id IN (SELECT entity_id FROM records WHERE user_id = ?)", user.UserId).First(&entity).Error
+	if err != nil {
+		t.Fatal("Couldn't get an entity of the user's records: ", err)
+	}
+
+	deletion, err := user.GraceDeleteWithTx(0, time.Hour, nil, tx)
+	if err != nil {
+		t.Fatal("Couldn't delete user: ", err)
+	}
+
+	var subject UUID
+	subject.New()
+	moved, err := deletion.PseudonymizeRecordsWithTx(subject, []string{entity.Name}, nil, tx)
+	if err != nil || moved == 0 {
+		t.Fatalf("Expected records moved, got %v (err: %v)", moved, err)
+	}
+
+	var records []Record
+	err = tx.Where("user_id = ?", subject).Find(&records).Error
+	if err != nil || len(records) != moved {
+		t.Fatalf("Expected %v live records under the subject, got %v (err: %v)", moved, len(records), err)
+	}
+	for _, record := range records {
+		week := WeekOf(record.RecordAt)
+		if !record.RecordAt.Equal(week) || !record.CreatedAt.Equal(week) || !record.UpdatedAt.Equal(week) {
+			t.Fatalf("Expected record %v timestamps coarsened to %v, got %v %v %v", record.ID, week, record.RecordAt, record.CreatedAt, record.UpdatedAt)
+		}
+	}
+}
@@ -0,0 +1,125 @@
+package models
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/dabfleming/gorm"
+	"time"
+)
+
+// Before deleted_at was nullable every Save wrote the zero time to it, so
+// gorm, and these conditions, count anything up to 0001-01-02 as live.
+const (
+	DeletedCondition = "deleted_at > '0001-01-02'"
+	LiveCondition    = "(deleted_at IS NULL OR deleted_at <= '0001-01-02')"
+)
+
+// A time that may be NULL, as deleted_at is for rows that aren't deleted.
+// The zero time, and anything else in year 1, scans as NULL.
+type NullTime struct {
+	Time  time.Time
+	Valid bool
+}
+
+// Implement sql.Scanner interface for NullTime
+func (n *NullTime) Scan(src interface{}) error {
+	if src == nil {
+		n.Time, n.Valid = time.Time{}, false
+		return nil
+	}
+	t, ok := src.(time.Time)
+	if !ok {
+		return fmt.Errorf("Can't scan %T into NullTime", src)
+	}
+	if t.Year() <= 1 {
+		n.Time, n.Valid = time.Time{}, false
+		return nil
+	}
+	n.Time, n.Valid = t, true
+	return nil
+}
+
+// Implement driver.Valuer interface for NullTime
+func (n NullTime) Value() (driver.Value, error) {
+	if !n.Valid {
+		return nil, nil
+	}
+	return n.Time, nil
+}
+
+// NULL as JSON null, otherwise the time.
+func (n NullTime) MarshalJSON() ([]byte, error) {
+	if !n.Valid {
+		return []byte("null"), nil
+	}
+	return json.Marshal(n.Time)
+}
+
+// Whether the row has been soft deleted.
+func (s SoftDelete) IsDeleted() bool {
+	return s.DeletedAt.Valid
+}
+
+// Scope including soft deleted rows.
+func WithDeleted(db *gorm.DB) *gorm.DB {
+	return db.Unscoped()
+}
+
+// Scope of soft deleted rows only.
+func OnlyDeleted(db *gorm.DB) *gorm.DB {
+	return db.Unscoped().Where(DeletedCondition)
+}
+
+// Scope of rows soft deleted between from and to, inclusive.
+func DeletedBetween(from, to time.Time) func(*gorm.DB) *gorm.DB {
+	return func(db *gorm.DB) *gorm.DB {
+		return db.Unscoped().Where(DeletedCondition).Where("deleted_at BETWEEN ? AND ?", from, to)
+	}
+}
+
+// Undelete every row query selects. query must be on a soft-deletable
+// model, e.g. tx.Model(&Record{}).Where("user_id = ?", id).
+func RestoreRows(query *gorm.DB) *gorm.DB {
+	return query.Scopes(OnlyDeleted).UpdateColumn("deleted_at", nil)
+}
+
+// Hard delete every row of model's table query selects, whether soft
+// deleted or not.
+func ForceDeleteRows(query *gorm.DB, model interface{}) *gorm.DB {
+	return query.Scopes(WithDeleted).Delete(model)
+}
+
+// A model with Restore and ForceDelete, see soft_delete_models.go.
+type SoftDeletable interface {
+	Restore(tx *gorm.DB) error
+	ForceDelete(tx *gorm.DB) error
+}
+
+// Returned by Restore and ForceDelete on a model without its primary key,
+// which would otherwise touch every row of the table.
+var ErrBlankKey = errors.New("Model has no primary key set")
+
+// Undelete model, a soft-deletable model whose primary key column key
+// holds id.
+func restoreModel(model interface{}, key string, id int, s *SoftDelete, tx *gorm.DB) error {
+	if id == 0 {
+		return ErrBlankKey
+	}
+	err := RestoreRows(tx.Model(model).Where(key+" = ?", id)).Error
+	if err != nil {
+		return err
+	}
+	s.DeletedAt = NullTime{}
+	return nil
+}
+
+// Hard delete model, a soft-deletable model whose primary key column key
+// holds id.
+func forceDeleteModel(model interface{}, key string, id int, tx *gorm.DB) error {
+	if id == 0 {
+		return ErrBlankKey
+	}
+	return ForceDeleteRows(tx.Where(key+" = ?", id), model).Error
+}
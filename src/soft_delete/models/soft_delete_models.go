@@ -0,0 +1,137 @@
+package models
+
+import (
+	"github.com/dabfleming/gorm"
+)
+
+// Restore and ForceDelete for every soft-deletable model. Restore undeletes
+// the row, ForceDelete hard deletes it; both need the primary key set and
+// return ErrBlankKey if it isn't.
+
+func (m *User) Restore(tx *gorm.DB) error {
+	return restoreModel(m, "id", m.ID, &m.SoftDelete, tx)
+}
+
+func (m *User) ForceDelete(tx *gorm.DB) error {
+	return forceDeleteModel(m, "id", m.ID, tx)
+}
+
+func (m *UserState) Restore(tx *gorm.DB) error {
+	return restoreModel(m, "id", m.ID, &m.SoftDelete, tx)
+}
+
+func (m *UserState) ForceDelete(tx *gorm.DB) error {
+	return forceDeleteModel(m, "id", m.ID, tx)
+}
+
+func (m *UserSettings) Restore(tx *gorm.DB) error {
+	return restoreModel(m, "id", m.ID, &m.SoftDelete, tx)
+}
+
+func (m *UserSettings) ForceDelete(tx *gorm.DB) error {
+	return forceDeleteModel(m, "id", m.ID, tx)
+}
+
+func (m *UserEmail) Restore(tx *gorm.DB) error {
+	return restoreModel(m, "id", m.ID, &m.SoftDelete, tx)
+}
+
+func (m *UserEmail) ForceDelete(tx *gorm.DB) error {
+	return forceDeleteModel(m, "id", m.ID, tx)
+}
+
+func (m *UserLog) Restore(tx *gorm.DB) error {
+	return restoreModel(m, "id", m.ID, &m.SoftDelete, tx)
+}
+
+func (m *UserLog) ForceDelete(tx *gorm.DB) error {
+	return forceDeleteModel(m, "id", m.ID, tx)
+}
+
+func (m *UserAddress) Restore(tx *gorm.DB) error {
+	return restoreModel(m, "id", m.ID, &m.SoftDelete, tx)
+}
+
+func (m *UserAddress) ForceDelete(tx *gorm.DB) error {
+	return forceDeleteModel(m, "id", m.ID, tx)
+}
+
+func (m *Session) Restore(tx *gorm.DB) error {
+	return restoreModel(m, "id", m.ID, &m.SoftDelete, tx)
+}
+
+func (m *Session) ForceDelete(tx *gorm.DB) error {
+	return forceDeleteModel(m, "id", m.ID, tx)
+}
+
+func (m *SessionDevice) Restore(tx *gorm.DB) error {
+	return restoreModel(m, "session_id", m.SessionId, &m.SoftDelete, tx)
+}
+
+func (m *SessionDevice) ForceDelete(tx *gorm.DB) error {
+	return forceDeleteModel(m, "session_id", m.SessionId, tx)
+}
+
+func (m *Permission) Restore(tx *gorm.DB) error {
+	return restoreModel(m, "id", m.ID, &m.SoftDelete, tx)
+}
+
+func (m *Permission) ForceDelete(tx *gorm.DB) error {
+	return forceDeleteModel(m, "id", m.ID, tx)
+}
+
+func (m *Association) Restore(tx *gorm.DB) error {
+	return restoreModel(m, "id", m.ID, &m.SoftDelete, tx)
+}
+
+func (m *Association) ForceDelete(tx *gorm.DB) error {
+	return forceDeleteModel(m, "id", m.ID, tx)
+}
+
+func (m *Type) Restore(tx *gorm.DB) error {
+	return restoreModel(m, "id", m.ID, &m.SoftDelete, tx)
+}
+
+func (m *Type) ForceDelete(tx *gorm.DB) error {
+	return forceDeleteModel(m, "id", m.ID, tx)
+}
+
+func (m *Measure) Restore(tx *gorm.DB) error {
+	return restoreModel(m, "id", m.ID, &m.SoftDelete, tx)
+}
+
+func (m *Measure) ForceDelete(tx *gorm.DB) error {
+	return forceDeleteModel(m, "id", m.ID, tx)
+}
+
+func (m *Entity) Restore(tx *gorm.DB) error {
+	return restoreModel(m, "id", m.ID, &m.SoftDelete, tx)
+}
+
+func (m *Entity) ForceDelete(tx *gorm.DB) error {
+	return forceDeleteModel(m, "id", m.ID, tx)
+}
+
+func (m *Record) Restore(tx *gorm.DB) error {
+	return restoreModel(m, "id", m.ID, &m.SoftDelete, tx)
+}
+
+func (m *Record) ForceDelete(tx *gorm.DB) error {
+	return forceDeleteModel(m, "id", m.ID, tx)
+}
+
+func (m *Role) Restore(tx *gorm.DB) error {
+	return restoreModel(m, "id", m.ID, &m.SoftDelete, tx)
+}
+
+func (m *Role) ForceDelete(tx *gorm.DB) error {
+	return forceDeleteModel(m, "id", m.ID, tx)
+}
+
+func (m *UserAsset) Restore(tx *gorm.DB) error {
+	return restoreModel(m, "id", m.ID, &m.SoftDelete, tx)
+}
+
+func (m *UserAsset) ForceDelete(tx *gorm.DB) error {
+	return forceDeleteModel(m, "id", m.ID, tx)
+}
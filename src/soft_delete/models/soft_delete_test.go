@@ -0,0 +1,102 @@
+package models
+
+import (
+	"encoding/json"
+	"soft_delete/driver/database"
+	"testing"
+	"time"
+)
+
+func TestNullTime(t *testing.T) {
+	var n NullTime
+
+	err := n.Scan(nil)
+	if err != nil || n.Valid {
+		t.Fatalf("Expected NULL to scan as not valid, got %#v (err: %v)", n, err)
+	}
+	value, _ := n.Value()
+	if value != nil {
+		t.Fatalf("Expected an invalid NullTime to be NULL, got %v", value)
+	}
+
+	err = n.Scan(time.Time{})
+	if err != nil || n.Valid {
+		t.Fatalf("Expected the zero time to scan as not valid, got %#v (err: %v)", n, err)
+	}
+
+	err = n.Scan(time.Date(1, 1, 1, 12, 0, 0, 0, time.UTC))
+	if err != nil || n.Valid {
+		t.Fatalf("Expected a year 1 time to scan as not valid, got %#v (err: %v)", n, err)
+	}
+
+	raw, err := json.Marshal(n)
+	if err != nil || string(raw) != "null" {
+		t.Fatalf("Expected an invalid NullTime to marshal as null, got %s (err: %v)", raw, err)
+	}
+
+	now := time.Now()
+	err = n.Scan(now)
+	if err != nil || !n.Valid || !n.Time.Equal(now) {
+		t.Fatalf("Expected %v to scan as valid, got %#v (err: %v)", now, n, err)
+	}
+}
+
+func TestSoftDeleteScopes(t *testing.T) {
+	var state, lookup UserState
+
+	tx := database.App.Begin()
+	defer tx.Rollback()
+
+	err := tx.First(&state).Error
+	if err != nil {
+		t.Fatal("Couldn't get a user state: ", err)
+	}
+	if state.IsDeleted() {
+		t.Fatal("Scoped query returned a deleted row")
+	}
+
+	err = tx.Delete(&state).Error
+	if err != nil {
+		t.Fatal("Couldn't delete user state: ", err)
+	}
+
+	err = tx.Scopes(OnlyDeleted).Where("id = ?", state.ID).First(&lookup).Error
+	if err != nil || !lookup.IsDeleted() {
+		t.Fatalf("Deleted row not found by OnlyDeleted: %#v (err: %v)", lookup, err)
+	}
+
+	err = lookup.Restore(tx)
+	if err != nil {
+		t.Fatal("Couldn't restore user state: ", err)
+	}
+	if lookup.IsDeleted() {
+		t.Fatal("Restored row still marked deleted")
+	}
+
+	err = tx.Where("id = ?", state.ID).First(&lookup).Error
+	if err != nil {
+		t.Fatal("Row not visible after restore: ", err)
+	}
+
+	err = lookup.ForceDelete(tx)
+	if err != nil {
+		t.Fatal("Couldn't force delete user state: ", err)
+	}
+
+	if !tx.Scopes(WithDeleted).Where("id = ?", state.ID).First(&lookup).RecordNotFound() {
+		t.Fatal("Row still present after force delete")
+	}
+}
+
+func TestSoftDeleteHelpersNeedKey(t *testing.T) {
+	// A blank key is refused before tx is used, so nil will do
+	if err := (&User{}).ForceDelete(nil); err != ErrBlankKey {
+		t.Fatalf("Expected ErrBlankKey force deleting a blank User, got %v", err)
+	}
+	if err := (&Record{}).Restore(nil); err != ErrBlankKey {
+		t.Fatalf("Expected ErrBlankKey restoring a blank Record, got %v", err)
+	}
+	if err := (&SessionDevice{}).ForceDelete(nil); err != ErrBlankKey {
+		t.Fatalf("Expected ErrBlankKey force deleting a blank SessionDevice, got %v", err)
+	}
+}
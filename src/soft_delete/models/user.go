@@ -123,6 +123,41 @@ func (u *User) IsLead() bool {
 	return isLead
 }
 
+func (u *User) IsAdmin() bool {
+	db := database.App
+	var isAdmin bool = false
+
+	var roles []Role = make([]Role, 0)
+	err := db.Model(u).Association("Roles").Find(&roles).Error
+	if err != nil {
+		log.Println("Error finding roles for user: ", err.Error())
+		return false
+	}
+
+	for _, role := range roles {
+		if role.Name == "admin" {
+			isAdmin = true
+		}
+	}
+
+	return isAdmin
+}
+
+// The address to contact the user at: their primary email if set,
+// otherwise their oldest verified email, or their oldest email if none is
+// verified.
+func (u *User) PrimaryEmailWithTx(tx *gorm.DB) (UserEmail, error) {
+	var email UserEmail
+	if u.PrimaryEmailId != 0 {
+		err := tx.Where("id = ? and user_id = ?", u.PrimaryEmailId, u.UserId).First(&email).Error
+		if err != gorm.RecordNotFound {
+			return email, err
+		}
+	}
+	err := tx.Where("user_id = ?", u.UserId).Order("verified desc, id").First(&email).Error
+	return email, err
+}
+
 func (u *User) AddLog(name, message string, meta Metadata) error {
 	var tx *gorm.DB
 	tx = database.App.Begin()
@@ -139,6 +174,12 @@ func (u *User) AddLog(name, message string, meta Metadata) error {
 }
 
 func (u *User) AddLogWithTx(name, message string, meta Metadata, tx *gorm.DB) error {
+	_, err := u.AddLogReturningWithTx(name, message, meta, tx)
+	return err
+}
+
+// AddLogWithTx, returning the new log.
+func (u *User) AddLogReturningWithTx(name, message string, meta Metadata, tx *gorm.DB) (*UserLog, error) {
 	userLog := UserLog{
 		UserId:  u.UserId,
 		Name:    name,
@@ -148,9 +189,9 @@ func (u *User) AddLogWithTx(name, message string, meta Metadata, tx *gorm.DB) er
 	err := tx.Create(&userLog).Error
 	if err != nil {
 		log.Print("Error creating UserLog.", err)
-		return err
+		return nil, err
 	}
-	return nil
+	return &userLog, nil
 }
 
 func (u *User) RemoveRole(name string) error {
@@ -235,6 +276,12 @@ func (u *User) SetState(typeStr, state string) error {
 }
 
 func (u *User) SetStateWithTx(typeStr, state string, tx *gorm.DB) error {
+	_, err := u.SetStateReturningWithTx(typeStr, state, tx)
+	return err
+}
+
+// SetStateWithTx, returning the new state.
+func (u *User) SetStateReturningWithTx(typeStr, state string, tx *gorm.DB) (*UserState, error) {
 	var userState UserState
 	var err error
 
@@ -242,7 +289,7 @@ func (u *User) SetStateWithTx(typeStr, state string, tx *gorm.DB) error {
 	err = tx.Where("user_id = ? AND type = ?", u.UserId, typeStr).Delete(UserState{}).Error
 	if err != nil {
 		log.Print("db error clearing previous user state", u, typeStr)
-		return err
+		return nil, err
 	}
 
 	// Set new state
@@ -255,10 +302,10 @@ func (u *User) SetStateWithTx(typeStr, state string, tx *gorm.DB) error {
 	err = tx.Create(&userState).Error
 	if err != nil {
 		log.Print("db error creating new user state", u, typeStr)
-		return err
+		return nil, err
 	}
 
-	return nil
+	return &userState, nil
 }
 
 func (u *User) SetAssociation(userKey, targetKey string, target *User) error {
@@ -283,6 +330,26 @@ func (p *Participant) SetCoach(coach *Coach) error {
 	return coach.associate("coach", "participant", &(p.User))
 }
 
+// Returns the coach:participant associations currently pointing at this coach.
+func (c *Coach) ParticipantAssociationsWithTx(tx *gorm.DB) ([]Association, error) {
+	var assocs []Association
+	err := tx.Where("type = ? AND users #>> '{coach}' = ?", "coach:participant", c.UserId.String()).Find(&assocs).Error
+	if err != nil && err != gorm.RecordNotFound {
+		return nil, err
+	}
+	return assocs, nil
+}
+
+// Returns the number of participants currently assigned to this coach.
+func (c *Coach) CaseloadWithTx(tx *gorm.DB) (int, error) {
+	var count int
+	err := tx.Model(&Association{}).Where("type = ? AND users #>> '{coach}' = ?", "coach:participant", c.UserId.String()).Count(&count).Error
+	if err != nil {
+		return 0, err
+	}
+	return count, nil
+}
+
 func (u *User) associate(userKey, targetKey string, target *User) error {
 	var assoc Association
 
@@ -0,0 +1,51 @@
+package models
+
+import (
+	"github.com/dabfleming/gorm"
+)
+
+// Everything held on one user, deleted rows included. Assets are kept out
+// of the JSON as they are written out as files of their own.
+type UserGraph struct {
+	UserId       string         `json:"user_id"`
+	User         User           `json:"user"`
+	Emails       []UserEmail    `json:"emails"`
+	Addresses    []UserAddress  `json:"addresses"`
+	Settings     []UserSettings `json:"settings"`
+	States       []UserState    `json:"states"`
+	Logs         []UserLog      `json:"logs"`
+	Associations []Association  `json:"associations"`
+	Records      []Record       `json:"records"`
+	Assets       []UserAsset    `json:"-"`
+}
+
+// Load the user's graph. Records come with their Type, Entity and Measure.
+func LoadUserGraphWithTx(userId UUID, tx *gorm.DB) (*UserGraph, error) {
+	db := tx.Scopes(WithDeleted)
+	graph := &UserGraph{UserId: userId.String()}
+
+	err := db.Where("user_id = ?", userId).First(&graph.User).Error
+	if err != nil {
+		return nil, err
+	}
+
+	lists := []interface{}{&graph.Emails, &graph.Addresses, &graph.Settings, &graph.States, &graph.Logs, &graph.Assets}
+	for _, list := range lists {
+		err = db.Where("user_id = ?", userId).Order("id").Find(list).Error
+		if err != nil && err != gorm.RecordNotFound {
+			return nil, err
+		}
+	}
+
+	err = db.Where("EXISTS (SELECT 1 FROM jsonb_each_text(users) WHERE value = ?)", userId.String()).Order("id").Find(&graph.Associations).Error
+	if err != nil && err != gorm.RecordNotFound {
+		return nil, err
+	}
+
+	err = db.Where("user_id = ?", userId).Preload("Type").Preload("Entity").Preload("Measure").Order("record_at").Find(&graph.Records).Error
+	if err != nil && err != gorm.RecordNotFound {
+		return nil, err
+	}
+
+	return graph, nil
+}
@@ -0,0 +1,30 @@
+package models
+
+import (
+	"soft_delete/driver/database"
+	"testing"
+)
+
+func TestLoadUserGraph(t *testing.T) {
+	var user User
+
+	err := database.App.First(&user).Error
+	if err != nil {
+		t.Fatal("Couldn't get a user: ", err)
+	}
+
+	graph, err := LoadUserGraphWithTx(user.UserId, database.App)
+	if err != nil {
+		t.Fatal("Couldn't load user graph: ", err)
+	}
+
+	if graph.User.ID != user.ID || graph.UserId != user.UserId.String() {
+		t.Fatalf("Graph is for the wrong user: %v", graph.UserId)
+	}
+
+	for _, record := range graph.Records {
+		if record.EntityId != 0 && record.Entity.ID != record.EntityId {
+			t.Errorf("Record %v entity not loaded", record.ID)
+		}
+	}
+}
@@ -0,0 +1,129 @@
+package models
+
+import (
+	"github.com/dabfleming/gorm"
+	"time"
+)
+
+// What is held on one user, for support to see what a deletion would
+// touch. Lists hold live rows; soft deleted rows are only counted, in
+// DeletedRows.
+type UserInspection struct {
+	UserId       string        `json:"user_id"`
+	User         User          `json:"user"`
+	Deleted      bool          `json:"deleted"`
+	DeletedAt    *time.Time    `json:"deleted_at,omitempty"`
+	Roles        []string      `json:"roles"`
+	States       []UserState   `json:"states"`
+	Emails       []UserEmail   `json:"emails"`
+	Addresses    []UserAddress `json:"addresses"`
+	Associations []Association `json:"associations"`
+	Records      []EntityCount `json:"records"`
+	Assets       []AssetSize   `json:"assets"`
+	Sessions     []SessionInfo `json:"sessions"`
+
+	// Rows in each UserCascade table, live and soft deleted
+	LiveRows    CascadeCounts `json:"live_rows"`
+	DeletedRows CascadeCounts `json:"deleted_rows"`
+}
+
+// Live records of one entity.
+type EntityCount struct {
+	Entity string `json:"entity"`
+	Count  int64  `json:"count"`
+}
+
+// An asset without its data.
+type AssetSize struct {
+	ID      int    `json:"id"`
+	Type    string `json:"type"`
+	Bytes   int64  `json:"bytes"`
+	Deleted bool   `json:"deleted"`
+}
+
+// A session without its token.
+type SessionInfo struct {
+	ID        int       `json:"id"`
+	CreatedAt time.Time `json:"created_at"`
+	Deleted   bool      `json:"deleted"`
+}
+
+// Inspect the user, deleted or not, reading through tx.
+func InspectUserWithTx(userId UUID, tx *gorm.DB) (*UserInspection, error) {
+	db := tx.Scopes(WithDeleted)
+	inspection := &UserInspection{UserId: userId.String()}
+
+	err := db.Where("user_id = ?", userId).First(&inspection.User).Error
+	if err != nil {
+		return nil, err
+	}
+	if inspection.User.IsDeleted() {
+		inspection.Deleted = true
+		inspection.DeletedAt = &inspection.User.DeletedAt.Time
+	}
+
+	err = tx.Table("roles").Joins("JOIN user_x_role ON user_x_role.role_id = roles.id").
+		Where("user_x_role.user_id = ?", inspection.User.ID).Order("roles.name").Pluck("roles.name", &inspection.Roles).Error
+	if err != nil && err != gorm.RecordNotFound {
+		return nil, err
+	}
+
+	lists := []interface{}{&inspection.States, &inspection.Emails, &inspection.Addresses}
+	for _, list := range lists {
+		err = tx.Where("user_id = ?", userId).Order("id").Find(list).Error
+		if err != nil && err != gorm.RecordNotFound {
+			return nil, err
+		}
+	}
+
+	err = tx.Where("EXISTS (SELECT 1 FROM jsonb_each_text(users) WHERE value = ?)", userId.String()).Order("id").Find(&inspection.Associations).Error
+	if err != nil && err != gorm.RecordNotFound {
+		return nil, err
+	}
+
+	err = tx.Raw(`SELECT entities.name AS entity, count(*) AS count
+		FROM (SELECT entity_id FROM records WHERE user_id = ? AND `+LiveCondition+`) records
+		JOIN entities ON entities.id = records.entity_id
+		GROUP BY entities.name ORDER BY entities.name`, userId).Scan(&inspection.Records).Error
+	if err != nil && err != gorm.RecordNotFound {
+		return nil, err
+	}
+
+	err = tx.Raw(`SELECT id, type, coalesce(octet_length(data), 0) AS bytes, `+DeletedCondition+` AS deleted
+		FROM user_assets WHERE user_id = ? ORDER BY id`, userId).Scan(&inspection.Assets).Error
+	if err != nil && err != gorm.RecordNotFound {
+		return nil, err
+	}
+
+	err = tx.Raw(`SELECT id, created_at, `+DeletedCondition+` AS deleted
+		FROM sessions WHERE user_id = ? ORDER BY id`, userId).Scan(&inspection.Sessions).Error
+	if err != nil && err != gorm.RecordNotFound {
+		return nil, err
+	}
+
+	inspection.LiveRows, inspection.DeletedRows, err = CascadeRowsWithTx(userId, tx)
+	if err != nil {
+		return nil, err
+	}
+	return inspection, nil
+}
+
+// Count the user's rows in each UserCascade table, live and soft deleted.
+func CascadeRowsWithTx(userId UUID, tx *gorm.DB) (live, deleted CascadeCounts, err error) {
+	live, deleted = CascadeCounts{}, CascadeCounts{}
+	for _, step := range UserCascade {
+		var n int64
+		err = tx.Table(step.Table).Where(step.Where, userId).Where(LiveCondition).Count(&n).Error
+		if err != nil {
+			return nil, nil, err
+		}
+		live[step.Table] = n
+
+		err = tx.Table(step.Table).Where(step.Where, userId).Where(DeletedCondition).Count(&n).Error
+		if err != nil {
+			return nil, nil, err
+		}
+		deleted[step.Table] = n
+	}
+	return live, deleted, nil
+}
@@ -173,3 +173,35 @@ func TestRoleDuplication(t *testing.T) {
 		t.Fatal("Test role present after remove.")
 	}
 }
+
+func TestCoachCaseload(t *testing.T) {
+	var users []User
+
+	db := *(database.App)
+	db.Find(&users)
+	if len(users) < 2 {
+		t.Fatal("Less than 2 users, can't associate.")
+	}
+
+	p := Participant{users[0]}
+	c := Coach{users[1]}
+
+	err := p.SetCoach(&c)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	count, err := c.CaseloadWithTx(&db)
+	if err != nil {
+		t.Fatal("Error counting caseload: ", err)
+	}
+
+	assocs, err := c.ParticipantAssociationsWithTx(&db)
+	if err != nil {
+		t.Fatal("Error listing participants: ", err)
+	}
+
+	if count < 1 || count != len(assocs) {
+		t.Fatalf("Caseload %v does not match %v participant associations.", count, len(assocs))
+	}
+}
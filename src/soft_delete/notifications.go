@@ -0,0 +1,223 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"github.com/dabfleming/gorm"
+	"log"
+	"soft_delete/configuration"
+	"soft_delete/driver/database"
+	"soft_delete/models"
+	"soft_delete/notify"
+	"sort"
+)
+
+// Job types emailing a departed participant, and an employer contact the
+// participants of theirs a run deleted
+const (
+	jobNotifyParticipant = "notify_participant"
+	jobNotifyEmployer    = "notify_employer"
+)
+
+// Whether the participant deleted with meta should be told, and their
+// employer's summary list them. Only participants matched from a list row
+// are, unless notifications are off or the row's reason suppresses them
+// (e.g. deceased).
+func shouldNotify(meta models.Metadata) bool {
+	if !configuration.GetConfiguration().Notifications.Enabled {
+		return false
+	}
+	if _, ok := meta["row"]; !ok {
+		return false
+	}
+	reason, _ := meta["reason"].(string)
+	if code, ok := configuration.Reason(reason); ok && code.SuppressNotification {
+		return false
+	}
+	return true
+}
+
+// Queue the participant's email within app.
+func enqueueParticipantNotification(app *gorm.DB, user models.User, meta models.Metadata) (*models.Job, error) {
+	employer, _ := meta["employer"].(string)
+	reason, _ := meta["reason"].(string)
+	job, err := models.EnqueueJobWithTx(jobNotifyParticipant, models.Metadata{
+		"user_id":  user.UserId.String(),
+		"employer": employer,
+		"reason":   reason,
+	}, app)
+	if err != nil {
+		return nil, fmt.Errorf("Error queueing notification: %v", err)
+	}
+	return job, nil
+}
+
+// Queue a summary for the contact of each employer whose participants the
+// run deleted. Never sends for dry runs, which delete no one.
+func (run *Run) notifyEmployers() {
+	if run.DryRun {
+		return
+	}
+
+	employers := make([]string, 0, len(run.departed))
+	for employer := range run.departed {
+		employers = append(employers, employer)
+	}
+	sort.Strings(employers)
+
+	for _, employer := range employers {
+		job, err := models.EnqueueJobWithTx(jobNotifyEmployer, models.Metadata{
+			"employer": employer,
+			"source":   run.Batch.Source,
+			"user_ids": run.departed[employer],
+		}, database.App)
+		if err != nil {
+			log.Print("Error queueing summary for ", employer, " ~ Err: ", err)
+			continue
+		}
+		log.Print("Queued summary for ", employer, " as job ", job.ID)
+	}
+	run.departed = nil
+}
+
+// Queue employer summaries, then log the report and write it to filename,
+// if given.
+func (run *Run) Finish(filename string) error {
+	run.notifyEmployers()
+	return run.Report.Finish(filename)
+}
+
+func newMailer() (notify.Mailer, error) {
+	conf := configuration.GetConfiguration().Notifications.SMTP
+	return notify.NewSMTPMailer(notify.SMTPConfig{
+		Host:     conf.Host,
+		Port:     conf.Port,
+		Username: conf.Username,
+		Password: conf.Password,
+		From:     conf.From,
+	})
+}
+
+// Returned by departedParticipant for a user restored since the job was
+// queued, who mustn't be told their account was closed.
+var errNotDeparted = errors.New("User is no longer deleted")
+
+// Who a deleted user was, read back from their soft deleted rows.
+// Returns errNotDeparted if the user has been restored.
+func departedParticipant(userId models.UUID, employer string) (notify.Participant, error) {
+	db := database.App.Scopes(models.WithDeleted)
+
+	user, err := findUser(db, userId.String())
+	if err != nil {
+		return notify.Participant{}, fmt.Errorf("No User data for %v: %v", userId, err)
+	}
+	if !user.IsDeleted() {
+		return notify.Participant{}, errNotDeparted
+	}
+	email, err := user.PrimaryEmailWithTx(db)
+	if err != nil {
+		return notify.Participant{}, fmt.Errorf("No Email data for %v: %v", userId, err)
+	}
+	first, last, err := intakeNames(db, userId)
+	if err != nil {
+		return notify.Participant{}, fmt.Errorf("No Intake Record data for %v: %v", userId, err)
+	}
+
+	return notify.Participant{
+		FirstName: first,
+		LastName:  last,
+		Email:     email.Email,
+		Employer:  employer,
+	}, nil
+}
+
+// Runs a notify_participant job: {"user_id": ..., "employer": ..., "reason": ...}
+func notifyParticipantJob(payload models.Metadata) error {
+	var userId models.UUID
+	id, _ := payload["user_id"].(string)
+	userId.Parse(id)
+	if userId.UUID == nil {
+		return permanentJobError{fmt.Errorf("Invalid user_id: %v", payload["user_id"])}
+	}
+	employer, _ := payload["employer"].(string)
+	reason, _ := payload["reason"].(string)
+
+	conf := configuration.GetConfiguration().Notifications
+	tmpl, err := notify.LoadTemplate(conf.ParticipantTemplate, notify.DefaultParticipantTemplate)
+	if err != nil {
+		return permanentJobError{fmt.Errorf("Error loading participant template: %v", err)}
+	}
+
+	participant, err := departedParticipant(userId, employer)
+	if err == errNotDeparted {
+		log.Print("Not notifying ", userId, ", restored since the deletion")
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if code, ok := configuration.Reason(reason); ok {
+		participant.Reason = code.Description
+	}
+
+	subject, body, err := tmpl.Render(participant)
+	if err != nil {
+		return permanentJobError{fmt.Errorf("Error rendering participant template: %v", err)}
+	}
+
+	mailer, err := newMailer()
+	if err != nil {
+		return err
+	}
+	return mailer.Send(participant.Email, subject, body)
+}
+
+// Runs a notify_employer job: {"employer": ..., "source": ..., "user_ids": [...]}
+func notifyEmployerJob(payload models.Metadata) error {
+	employer, _ := payload["employer"].(string)
+	source, _ := payload["source"].(string)
+	ids, _ := payload["user_ids"].([]interface{})
+
+	conf := configuration.GetConfiguration().Notifications
+	contact, ok := conf.EmployerContacts[employer]
+	if !ok {
+		return permanentJobError{fmt.Errorf("No contact configured for employer %v", employer)}
+	}
+	tmpl, err := notify.LoadTemplate(conf.EmployerTemplate, notify.DefaultEmployerTemplate)
+	if err != nil {
+		return permanentJobError{fmt.Errorf("Error loading employer template: %v", err)}
+	}
+
+	summary := notify.Summary{Employer: employer, Source: source}
+	for _, id := range ids {
+		var userId models.UUID
+		s, _ := id.(string)
+		userId.Parse(s)
+		if userId.UUID == nil {
+			return permanentJobError{fmt.Errorf("Invalid user_id: %v", id)}
+		}
+
+		participant, err := departedParticipant(userId, employer)
+		if err == errNotDeparted {
+			log.Print("Leaving ", userId, " out of ", employer, "'s summary, restored since the deletion")
+			continue
+		} else if err != nil {
+			return err
+		}
+		summary.Participants = append(summary.Participants, participant)
+	}
+	if len(summary.Participants) == 0 {
+		log.Print("Not notifying ", employer, ", every participant was restored")
+		return nil
+	}
+
+	subject, body, err := tmpl.Render(summary)
+	if err != nil {
+		return permanentJobError{fmt.Errorf("Error rendering employer template: %v", err)}
+	}
+
+	mailer, err := newMailer()
+	if err != nil {
+		return err
+	}
+	return mailer.Send(contact, subject, body)
+}
@@ -0,0 +1,155 @@
+// Package notify emails people about offboarding: departing participants
+// and their employer's contact. Messages are rendered from text templates
+// and sent over SMTP.
+package notify
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+)
+
+// Sends one plain text email.
+type Mailer interface {
+	Send(to, subject, body string) error
+}
+
+// Where mail is sent from. Username may be empty for servers, such as a
+// local test server, that don't authenticate.
+type SMTPConfig struct {
+	Host     string
+	Port     int
+	Username string
+	Password string
+	From     string
+}
+
+type smtpMailer struct {
+	conf SMTPConfig
+}
+
+func NewSMTPMailer(conf SMTPConfig) (Mailer, error) {
+	if conf.Host == "" || conf.From == "" {
+		return nil, fmt.Errorf("SMTP host and from address are required")
+	}
+	if conf.Port == 0 {
+		conf.Port = 25
+	}
+	return &smtpMailer{conf: conf}, nil
+}
+
+func (m *smtpMailer) Send(to, subject, body string) error {
+	var auth smtp.Auth
+	if m.conf.Username != "" {
+		auth = smtp.PlainAuth("", m.conf.Username, m.conf.Password, m.conf.Host)
+	}
+	addr := net.JoinHostPort(m.conf.Host, strconv.Itoa(m.conf.Port))
+	return smtp.SendMail(addr, auth, m.conf.From, []string{to}, Message(m.conf.From, to, subject, body, time.Now()))
+}
+
+// The RFC 5322 message for a plain text email.
+func Message(from, to, subject, body string, date time.Time) []byte {
+	var msg bytes.Buffer
+	fmt.Fprintf(&msg, "From: %v\r\n", from)
+	fmt.Fprintf(&msg, "To: %v\r\n", to)
+	fmt.Fprintf(&msg, "Subject: %v\r\n", strings.Replace(subject, "\n", " ", -1))
+	fmt.Fprintf(&msg, "Date: %v\r\n", date.Format(time.RFC1123Z))
+	msg.WriteString("MIME-Version: 1.0\r\n")
+	msg.WriteString("Content-Type: text/plain; charset=utf-8\r\n")
+	msg.WriteString("\r\n")
+	msg.WriteString(strings.Replace(strings.Replace(body, "\r\n", "\n", -1), "\n", "\r\n", -1))
+	return msg.Bytes()
+}
+
+// A message template. The template itself renders the body, and must
+// define "subject" rendering the subject line.
+type Template struct {
+	t *template.Template
+}
+
+// Parse the template file at path, or fallback if path is "".
+func LoadTemplate(path, fallback string) (*Template, error) {
+	text := fallback
+	if path != "" {
+		raw, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		text = string(raw)
+	}
+	return ParseTemplate(text)
+}
+
+func ParseTemplate(text string) (*Template, error) {
+	t, err := template.New("body").Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, err
+	}
+	if t.Lookup("subject") == nil {
+		return nil, fmt.Errorf("Template does not define \"subject\"")
+	}
+	return &Template{t: t}, nil
+}
+
+func (t *Template) Render(data interface{}) (subject, body string, err error) {
+	var buf bytes.Buffer
+	err = t.t.ExecuteTemplate(&buf, "subject", data)
+	if err != nil {
+		return "", "", err
+	}
+	subject = strings.TrimSpace(buf.String())
+
+	buf.Reset()
+	err = t.t.Execute(&buf, data)
+	if err != nil {
+		return "", "", err
+	}
+	return subject, strings.TrimSpace(buf.String()) + "\n", nil
+}
+
+// Used when no participant template is configured. Rendered with a
+// Participant.
+const DefaultParticipantTemplate = `{{define "subject"}}Your Newtopia account has been closed{{end}}
+Hi {{.FirstName}},
+
+{{if .Employer}}{{.Employer}} has let us know that you are no longer with them, so{{else}}As requested,{{end}} your Newtopia account has been closed and you have been signed out of the app.
+
+If you believe this is a mistake, reply to this email and we'll look into it.
+
+The Newtopia team
+`
+
+// Used when no employer template is configured. Rendered with a Summary.
+const DefaultEmployerTemplate = `{{define "subject"}}Newtopia offboarding summary: {{len .Participants}} participant(s){{end}}
+Hello,
+
+The following {{.Employer}} participant(s) have been offboarded from Newtopia ({{.Source}}):
+{{range .Participants}}
+  - {{.FirstName}} {{.LastName}} <{{.Email}}>{{end}}
+
+Their accounts can be restored on request until the grace period ends.
+
+The Newtopia team
+`
+
+// What a participant template is rendered with.
+type Participant struct {
+	FirstName string
+	LastName  string
+	Email     string
+	Employer  string
+	Reason    string
+}
+
+// What an employer template is rendered with.
+type Summary struct {
+	Employer     string
+	Source       string
+	Participants []Participant
+}
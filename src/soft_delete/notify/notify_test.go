@@ -0,0 +1,125 @@
+package notify
+
+import (
+	"bufio"
+	"net"
+	"strings"
+	"testing"
+)
+
+// A local stand-in for an SMTP server, accepting one message.
+type fakeSMTP struct {
+	listener net.Listener
+	messages chan string
+}
+
+func newFakeSMTP(t *testing.T) *fakeSMTP {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f := &fakeSMTP{listener: listener, messages: make(chan string, 1)}
+	go f.serve()
+	return f
+}
+
+func (f *fakeSMTP) serve() {
+	conn, err := f.listener.Accept()
+	if err != nil {
+		return
+	}
+	defer conn.Close()
+
+	r := bufio.NewReader(conn)
+	reply := func(line string) { conn.Write([]byte(line + "\r\n")) }
+	reply("220 localhost ESMTP")
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		command := strings.ToUpper(strings.TrimSpace(line))
+		switch {
+		case strings.HasPrefix(command, "EHLO"), strings.HasPrefix(command, "HELO"):
+			reply("250 localhost")
+		case command == "DATA":
+			reply("354 go ahead")
+			var data []string
+			for {
+				line, err = r.ReadString('\n')
+				if err != nil {
+					return
+				}
+				if line == ".\r\n" {
+					break
+				}
+				data = append(data, line)
+			}
+			f.messages <- strings.Join(data, "")
+			reply("250 queued")
+		case command == "QUIT":
+			reply("221 bye")
+			return
+		default:
+			reply("250 ok")
+		}
+	}
+}
+
+func TestSMTPMailerSend(t *testing.T) {
+	server := newFakeSMTP(t)
+	defer server.listener.Close()
+
+	addr := server.listener.Addr().(*net.TCPAddr)
+	mailer, err := NewSMTPMailer(SMTPConfig{Host: "127.0.0.1", Port: addr.Port, From: "offboarding@example.com"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = mailer.Send("pat@example.com", "Closed", "Hi Pat\n")
+	if err != nil {
+		t.Fatal("Couldn't send: ", err)
+	}
+
+	msg := <-server.messages
+	if !strings.Contains(msg, "To: pat@example.com\r\n") || !strings.Contains(msg, "Subject: Closed\r\n") || !strings.HasSuffix(msg, "Hi Pat\r\n") {
+		t.Fatalf("Unexpected message:\n%v", msg)
+	}
+}
+
+func TestDefaultTemplates(t *testing.T) {
+	participant, err := ParseTemplate(DefaultParticipantTemplate)
+	if err != nil {
+		t.Fatal(err)
+	}
+	subject, body, err := participant.Render(Participant{FirstName: "Pat", Employer: "Acme"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if subject == "" || !strings.Contains(body, "Hi Pat,") || !strings.Contains(body, "Acme has let us know") {
+		t.Fatalf("Unexpected participant email %q:\n%v", subject, body)
+	}
+
+	employer, err := ParseTemplate(DefaultEmployerTemplate)
+	if err != nil {
+		t.Fatal(err)
+	}
+	subject, body, err = employer.Render(Summary{
+		Employer:     "Acme",
+		Source:       "quit.csv",
+		Participants: []Participant{{FirstName: "Pat", LastName: "Doe", Email: "pat@example.com"}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(subject, "1 participant(s)") || !strings.Contains(body, "Pat Doe <pat@example.com>") {
+		t.Fatalf("Unexpected employer email %q:\n%v", subject, body)
+	}
+}
+
+func TestTemplateRequiresSubject(t *testing.T) {
+	_, err := ParseTemplate("Hi {{.FirstName}}")
+	if err == nil {
+		t.Fatal("Expected a template without a subject to be refused")
+	}
+}
@@ -0,0 +1,300 @@
+package main
+
+import (
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"github.com/codegangsta/cli"
+	"github.com/dabfleming/gorm"
+	jp "github.com/dustin/go-jsonpointer"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"soft_delete/driver/database"
+	"soft_delete/models"
+	"strconv"
+	"strings"
+)
+
+// Where the employer's member ID is kept in the Intake Record's Meta
+const memberIdPointer = "/member_id"
+
+var reconcileCommand = cli.Command{
+	Name:  "reconcile",
+	Usage: "Compare an employer's full roster with its active participants",
+	Flags: []cli.Flag{
+		cli.StringFlag{Name: "employer", Usage: "UUID or display name of the employer user"},
+		cli.StringFlag{Name: "roster", Usage: "roster CSV (first_name, last_name, email, member_id)"},
+		cli.StringFlag{Name: "out", Value: ".", Usage: "directory to write quit_candidates.csv, new_eligibles.csv and mismatches.csv to"},
+	},
+	Action: reconcileAction,
+}
+
+// One row of an employer's eligibility roster.
+type RosterEntry struct {
+	Row       int
+	FirstName string
+	LastName  string
+	Email     string
+	MemberId  string
+}
+
+// An active participant as we know them, for comparison with a roster.
+type participantProfile struct {
+	UserId    models.UUID
+	FirstName string
+	LastName  string
+	Email     string
+	Emails    []string
+	MemberId  string
+}
+
+// A field that differs between a participant and their roster entry.
+type fieldMismatch struct {
+	UserId      string
+	Row         int
+	Field       string
+	Participant string
+	Roster      string
+}
+
+func reconcileAction(c *cli.Context) {
+	err := reconcile(c.String("employer"), c.String("roster"), c.String("out"))
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+func reconcile(idOrName, rosterFile, outDir string) error {
+	if idOrName == "" || rosterFile == "" {
+		return errors.New("Error: --employer and --roster are required")
+	}
+
+	roster, err := readRoster(rosterFile)
+	if err != nil {
+		return err
+	}
+
+	employer, err := findEmployer(database.App, idOrName)
+	if err != nil {
+		return fmt.Errorf("No User data for this Company: %v ~ Err: %v", idOrName, err)
+	}
+
+	userIds, err := employerParticipants(database.App, employer)
+	if err != nil {
+		return fmt.Errorf("Error listing participants of %v: %v", employer.DisplayName, err)
+	}
+
+	participants := make([]participantProfile, 0, len(userIds))
+	for _, userId := range userIds {
+		profile, err := loadParticipantProfile(database.App, userId)
+		if err != nil {
+			return fmt.Errorf("Error loading participant %v: %v", userId, err)
+		}
+		participants = append(participants, profile)
+	}
+
+	quits, eligibles, mismatches := reconcileRoster(roster, participants, employer.DisplayName)
+
+	err = writeQuitList(filepath.Join(outDir, "quit_candidates.csv"), quits)
+	if err != nil {
+		return err
+	}
+	err = writeRoster(filepath.Join(outDir, "new_eligibles.csv"), eligibles)
+	if err != nil {
+		return err
+	}
+	err = writeMismatches(filepath.Join(outDir, "mismatches.csv"), mismatches)
+	if err != nil {
+		return err
+	}
+
+	log.Printf("Reconciled %v roster row(s) against %v participant(s) of %v.\n\tQuit candidates: %v\n\tNew eligibles: %v\n\tMismatches: %v",
+		len(roster), len(participants), employer.DisplayName, len(quits), len(eligibles), len(mismatches))
+	return nil
+}
+
+// Match roster entries to participants, by member ID when both have one
+// and by email otherwise. Participants without an entry become quit
+// candidates, entries without a participant become new eligibles.
+func reconcileRoster(roster []RosterEntry, participants []participantProfile, company string) ([]QuitRecord, []RosterEntry, []fieldMismatch) {
+	byMemberId := make(map[string]int)
+	byEmail := make(map[string]int)
+	for i, entry := range roster {
+		if entry.MemberId != "" {
+			byMemberId[entry.MemberId] = i
+		}
+		byEmail[strings.ToLower(entry.Email)] = i
+	}
+
+	matched := make(map[int]bool)
+	quits := make([]QuitRecord, 0)
+	mismatches := make([]fieldMismatch, 0)
+
+	for _, p := range participants {
+		i, ok := -1, false
+		if p.MemberId != "" {
+			i, ok = byMemberId[p.MemberId]
+		}
+		for _, email := range p.Emails {
+			if ok {
+				break
+			}
+			i, ok = byEmail[strings.ToLower(email)]
+		}
+		if !ok || matched[i] {
+			quits = append(quits, QuitRecord{
+				FirstName: p.FirstName,
+				LastName:  p.LastName,
+				Email:     p.Email,
+				Company:   company,
+			})
+			continue
+		}
+		matched[i] = true
+		mismatches = append(mismatches, compareProfile(p, roster[i])...)
+	}
+
+	eligibles := make([]RosterEntry, 0)
+	for i, entry := range roster {
+		if !matched[i] {
+			eligibles = append(eligibles, entry)
+		}
+	}
+
+	return quits, eligibles, mismatches
+}
+
+func compareProfile(p participantProfile, entry RosterEntry) []fieldMismatch {
+	mismatches := make([]fieldMismatch, 0)
+	compare := func(field, ours, theirs string) {
+		if !strings.EqualFold(strings.TrimSpace(ours), strings.TrimSpace(theirs)) {
+			mismatches = append(mismatches, fieldMismatch{
+				UserId:      p.UserId.String(),
+				Row:         entry.Row,
+				Field:       field,
+				Participant: ours,
+				Roster:      theirs,
+			})
+		}
+	}
+
+	// No Intake name on file is nothing to compare, not a mismatch
+	if p.FirstName != "" {
+		compare("first_name", p.FirstName, entry.FirstName)
+	}
+	if p.LastName != "" {
+		compare("last_name", p.LastName, entry.LastName)
+	}
+	compare("email", p.Email, entry.Email)
+	if entry.MemberId != "" {
+		compare("member_id", p.MemberId, entry.MemberId)
+	}
+	return mismatches
+}
+
+// Load names and member ID from the Intake Record, and the participant's
+// emails with the primary one first.
+func loadParticipantProfile(db *gorm.DB, userId models.UUID) (participantProfile, error) {
+	profile := participantProfile{UserId: userId}
+
+	var user models.User
+	err := db.Where("user_id = ?", userId).First(&user).Error
+	if err != nil {
+		return profile, err
+	}
+
+	var intake models.Record
+	err = db.Where("user_id = ? and entity_id in (SELECT id from entities where name = 'Intake')", userId).First(&intake).Error
+	if err != nil && err != gorm.RecordNotFound {
+		return profile, err
+	}
+	if intake.Meta != nil {
+		// A missing name is empty, not "<nil>"
+		profile.FirstName, _ = jp.Get(intake.Meta, "/first_name").(string)
+		profile.LastName, _ = jp.Get(intake.Meta, "/last_name").(string)
+		if memberId := jp.Get(intake.Meta, memberIdPointer); memberId != nil {
+			profile.MemberId = fmt.Sprintf("%v", memberId)
+		}
+	}
+
+	var emails []models.UserEmail
+	err = db.Where("user_id = ?", userId).Find(&emails).Error
+	if err != nil && err != gorm.RecordNotFound {
+		return profile, err
+	}
+	for _, email := range emails {
+		if email.ID == user.PrimaryEmailId {
+			profile.Emails = append([]string{email.Email}, profile.Emails...)
+		} else {
+			profile.Emails = append(profile.Emails, email.Email)
+		}
+	}
+	if len(profile.Emails) > 0 {
+		profile.Email = profile.Emails[0]
+	}
+
+	return profile, nil
+}
+
+func readRoster(filename string) ([]RosterEntry, error) {
+	file, err := os.Open(filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	r := csv.NewReader(file)
+	roster := make([]RosterEntry, 0)
+	for i := 0; ; i++ {
+		row, err := r.Read()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return nil, err
+		}
+
+		//Skip header row
+		if i == 0 {
+			continue
+		}
+		if len(row) < 4 {
+			return nil, fmt.Errorf("Error: roster row %v has %v column(s), expected 4", i, len(row))
+		}
+
+		roster = append(roster, RosterEntry{
+			Row:       i,
+			FirstName: row[0],
+			LastName:  row[1],
+			Email:     row[2],
+			MemberId:  row[3],
+		})
+	}
+	return roster, nil
+}
+
+// Write records in the format the quit command reads.
+func writeQuitList(filename string, records []QuitRecord) error {
+	rows := [][]string{{"first_name", "last_name", "email", "company"}}
+	for _, q := range records {
+		rows = append(rows, []string{q.FirstName, q.LastName, q.Email, q.Company})
+	}
+	return writeCSV(filename, rows)
+}
+
+func writeRoster(filename string, roster []RosterEntry) error {
+	rows := [][]string{{"first_name", "last_name", "email", "member_id"}}
+	for _, entry := range roster {
+		rows = append(rows, []string{entry.FirstName, entry.LastName, entry.Email, entry.MemberId})
+	}
+	return writeCSV(filename, rows)
+}
+
+func writeMismatches(filename string, mismatches []fieldMismatch) error {
+	rows := [][]string{{"user_id", "roster_row", "field", "participant_value", "roster_value"}}
+	for _, m := range mismatches {
+		rows = append(rows, []string{m.UserId, strconv.Itoa(m.Row), m.Field, m.Participant, m.Roster})
+	}
+	return writeCSV(filename, rows)
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"soft_delete/models"
+	"testing"
+)
+
+func TestReconcileRoster(t *testing.T) {
+	var kept, changed, gone models.UUID
+	kept.New()
+	changed.New()
+	gone.New()
+
+	participants := []participantProfile{
+		{UserId: kept, FirstName: "Ada", LastName: "Lovelace", Email: "ada@example.com", Emails: []string{"ada@example.com"}},
+		{UserId: changed, FirstName: "Alan", LastName: "Turing", Email: "alan@example.com", Emails: []string{"alan@example.com"}, MemberId: "M2"},
+		{UserId: gone, FirstName: "Grace", LastName: "Hopper", Email: "grace@example.com", Emails: []string{"grace@example.com"}},
+	}
+	roster := []RosterEntry{
+		{Row: 1, FirstName: "ada", LastName: "Lovelace", Email: "ADA@example.com"},
+		{Row: 2, FirstName: "Alan", LastName: "Turing", Email: "alan.turing@example.com", MemberId: "M2"},
+		{Row: 3, FirstName: "Edsger", LastName: "Dijkstra", Email: "edsger@example.com", MemberId: "M3"},
+	}
+
+	quits, eligibles, mismatches := reconcileRoster(roster, participants, "Acme")
+
+	if len(quits) != 1 || quits[0].Email != "grace@example.com" || quits[0].Company != "Acme" {
+		t.Fatalf("Unexpected quit candidates: %#v", quits)
+	}
+	if len(eligibles) != 1 || eligibles[0].MemberId != "M3" {
+		t.Fatalf("Unexpected new eligibles: %#v", eligibles)
+	}
+	if len(mismatches) != 1 || mismatches[0].Field != "email" || mismatches[0].UserId != changed.String() {
+		t.Fatalf("Unexpected mismatches: %#v", mismatches)
+	}
+}
+
+func TestCompareProfileMissingName(t *testing.T) {
+	var id models.UUID
+	id.New()
+
+	// No Intake name on file
+	p := participantProfile{UserId: id, Email: "ada@example.com"}
+	entry := RosterEntry{Row: 1, FirstName: "Ada", LastName: "Lovelace", Email: "ada@example.com"}
+	if mismatches := compareProfile(p, entry); len(mismatches) != 0 {
+		t.Fatalf("Expected no mismatch for a missing name, got %#v", mismatches)
+	}
+
+	p.FirstName = "Grace"
+	if mismatches := compareProfile(p, entry); len(mismatches) != 1 || mismatches[0].Field != "first_name" {
+		t.Fatalf("Expected a first_name mismatch, got %#v", mismatches)
+	}
+}
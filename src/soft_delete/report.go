@@ -0,0 +1,167 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"log"
+	"os"
+	"soft_delete/models"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Outcome codes reported for each processed row
+const (
+	OutcomeDeleted       = "deleted"
+	OutcomePreview       = "preview"
+	OutcomeScheduled     = "scheduled"
+	OutcomeRescheduled   = "rescheduled"
+	OutcomeErased        = "erased"
+	OutcomeRecorded      = "recorded"
+	OutcomeDeletedBefore = "already_deleted"
+	OutcomeCancelled     = "cancelled"
+	OutcomeInvalid       = "invalid"
+	OutcomeNoEmail       = "no_email"
+	OutcomeNoIntake      = "no_intake"
+	OutcomeNameMismatch  = "name_mismatch"
+	OutcomeNoEmployer    = "no_employer"
+	OutcomeNoAssociation = "no_association"
+	OutcomeLegalHold     = "legal_hold"
+	OutcomeError         = "error"
+)
+
+// What happened to a single input row (or enumerated participant).
+// Employer is the display name of the employer the row resolved to, empty
+// if it stopped before one was.
+type RowResult struct {
+	Row       int       `json:"row"`
+	UserId    string    `json:"user_id"`
+	FirstName string    `json:"first_name"`
+	LastName  string    `json:"last_name"`
+	Email     string    `json:"email"`
+	Company   string    `json:"company"`
+	Employer  string    `json:"employer"`
+	Outcome   string    `json:"outcome"`
+	Message   string    `json:"message"`
+	Date      time.Time `json:"date"`
+}
+
+// Outcome code for an error that stopped a row.
+func outcomeFor(err error) string {
+	if models.IsLegalHold(err) {
+		return OutcomeLegalHold
+	}
+	if err == models.ErrAlreadyDeleted {
+		return OutcomeDeletedBefore
+	}
+	return OutcomeError
+}
+
+// Returns a copy of r with the given outcome, message built as by fmt.Sprint.
+func (r RowResult) with(outcome string, message ...interface{}) RowResult {
+	r.Outcome = outcome
+	r.Message = fmt.Sprint(message...)
+	return r
+}
+
+// Per-row results of a single run.
+type RunReport struct {
+	Source     string
+	DryRun     bool
+	Invocation Invocation
+	Rows       []RowResult
+
+	// What happened after each user's deletion committed, by user UUID
+	SideEffects map[string][]string
+}
+
+func NewRunReport(source string, dryRun bool) *RunReport {
+	return &RunReport{
+		Source:      source,
+		DryRun:      dryRun,
+		Invocation:  invocation,
+		Rows:        make([]RowResult, 0),
+		SideEffects: make(map[string][]string),
+	}
+}
+
+// Note something done (or failed) for the user after their deletion.
+func (r *RunReport) SideEffect(userId models.UUID, note string) {
+	log.Print(userId, ": ", note)
+	r.SideEffects[userId.String()] = append(r.SideEffects[userId.String()], note)
+}
+
+// Log the row's message and add it to the report, dated now.
+func (r *RunReport) Add(result RowResult) {
+	log.Print(result.Message)
+	if result.Date.IsZero() {
+		result.Date = time.Now()
+	}
+	r.Rows = append(r.Rows, result)
+}
+
+// Number of rows for each outcome code.
+func (r *RunReport) Totals() map[string]int {
+	totals := make(map[string]int)
+	for _, row := range r.Rows {
+		totals[row.Outcome]++
+	}
+	return totals
+}
+
+// Log the totals and, when filename is set, write the rows to it as CSV.
+func (r *RunReport) Finish(filename string) error {
+	totals := r.Totals()
+	outcomes := make([]string, 0, len(totals))
+	for outcome := range totals {
+		outcomes = append(outcomes, outcome)
+	}
+	sort.Strings(outcomes)
+
+	log.Printf("Processed %v row(s) from %v (dry run: %v)", len(r.Rows), r.Source, r.DryRun)
+	log.Printf("\toperator: %v, build: %v, host: %v, config: %v", r.Invocation.Operator, r.Invocation.BuildId, r.Invocation.Host, r.Invocation.ConfigPath)
+	for _, outcome := range outcomes {
+		log.Printf("\t%v: %v", outcome, totals[outcome])
+	}
+
+	if filename == "" {
+		return nil
+	}
+	return r.WriteCSV(filename)
+}
+
+func (r *RunReport) WriteCSV(filename string) error {
+	rows := [][]string{{"row", "user_id", "first_name", "last_name", "email", "company", "outcome", "message", "side_effects", "operator", "build_id", "host", "config"}}
+	for _, row := range r.Rows {
+		rows = append(rows, []string{
+			strconv.Itoa(row.Row),
+			row.UserId,
+			row.FirstName,
+			row.LastName,
+			row.Email,
+			row.Company,
+			row.Outcome,
+			row.Message,
+			strings.Join(r.SideEffects[row.UserId], "; "),
+			r.Invocation.Operator,
+			r.Invocation.BuildId,
+			r.Invocation.Host,
+			r.Invocation.ConfigPath,
+		})
+	}
+	return writeCSV(filename, rows)
+}
+
+func writeCSV(filename string, rows [][]string) error {
+	file, err := os.Create(filename)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	w := csv.NewWriter(file)
+	w.WriteAll(rows)
+	return w.Error()
+}
@@ -0,0 +1,136 @@
+// Package research keeps the only link between a departed participant and
+// the pseudonymous subject ID their retained records were moved to. The
+// link lives in an encrypted, append-only key file outside the database.
+package research
+
+import (
+	"bufio"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"time"
+)
+
+// Environment variable holding the hex encoded AES-256 key
+const KeyEnv = "RESEARCH_MAPPING_KEY"
+
+type Mapping struct {
+	UserId    string    `json:"user_id"`
+	SubjectId string    `json:"subject_id"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Key file of one encrypted Mapping per line.
+type KeyFile struct {
+	path string
+	aead cipher.AEAD
+}
+
+// Decode a hex encoded 32 byte key, as found in KeyEnv.
+func ParseKey(hexKey string) ([]byte, error) {
+	key, err := hex.DecodeString(hexKey)
+	if err != nil {
+		return nil, fmt.Errorf("Research key is not hex: %v", err)
+	}
+	if len(key) != 32 {
+		return nil, fmt.Errorf("Research key must be 32 bytes, got %v", len(key))
+	}
+	return key, nil
+}
+
+// Open the key file at path with the key from KeyEnv.
+func OpenKeyFileFromEnv(path string) (*KeyFile, error) {
+	hexKey := os.Getenv(KeyEnv)
+	if hexKey == "" {
+		return nil, fmt.Errorf("%v is not set", KeyEnv)
+	}
+	key, err := ParseKey(hexKey)
+	if err != nil {
+		return nil, err
+	}
+	return OpenKeyFile(path, key)
+}
+
+func OpenKeyFile(path string, key []byte) (*KeyFile, error) {
+	if path == "" {
+		return nil, errors.New("No research key file configured")
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	return &KeyFile{path: path, aead: aead}, nil
+}
+
+// Encrypt m and append it to the key file.
+func (k *KeyFile) Append(m Mapping) error {
+	plain, err := json.Marshal(m)
+	if err != nil {
+		return err
+	}
+
+	nonce := make([]byte, k.aead.NonceSize())
+	_, err = rand.Read(nonce)
+	if err != nil {
+		return err
+	}
+	sealed := k.aead.Seal(nonce, nonce, plain, nil)
+
+	file, err := os.OpenFile(k.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+
+	_, err = file.WriteString(base64.StdEncoding.EncodeToString(sealed) + "\n")
+	if err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// Decrypt every mapping in the key file.
+func (k *KeyFile) ReadAll() ([]Mapping, error) {
+	file, err := os.Open(k.path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	mappings := make([]Mapping, 0)
+	scanner := bufio.NewScanner(file)
+	for line := 1; scanner.Scan(); line++ {
+		sealed, err := base64.StdEncoding.DecodeString(scanner.Text())
+		if err != nil {
+			return nil, fmt.Errorf("Key file line %v: %v", line, err)
+		}
+		if len(sealed) < k.aead.NonceSize() {
+			return nil, fmt.Errorf("Key file line %v: too short", line)
+		}
+
+		nonce := sealed[:k.aead.NonceSize()]
+		plain, err := k.aead.Open(nil, nonce, sealed[k.aead.NonceSize():], nil)
+		if err != nil {
+			return nil, fmt.Errorf("Key file line %v: %v", line, err)
+		}
+
+		var m Mapping
+		err = json.Unmarshal(plain, &m)
+		if err != nil {
+			return nil, fmt.Errorf("Key file line %v: %v", line, err)
+		}
+		mappings = append(mappings, m)
+	}
+	return mappings, scanner.Err()
+}
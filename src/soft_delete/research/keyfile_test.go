@@ -0,0 +1,72 @@
+package research
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestKeyFileRoundTrip(t *testing.T) {
+	dir, err := ioutil.TempDir("", "research")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	key := bytes.Repeat([]byte{7}, 32)
+	path := filepath.Join(dir, "mapping.key")
+
+	k, err := OpenKeyFile(path, key)
+	if err != nil {
+		t.Fatal("Couldn't open key file: ", err)
+	}
+
+	first := Mapping{UserId: "user-1", SubjectId: "subject-1", CreatedAt: time.Now().UTC()}
+	second := Mapping{UserId: "user-2", SubjectId: "subject-2", CreatedAt: time.Now().UTC()}
+	for _, m := range []Mapping{first, second} {
+		err = k.Append(m)
+		if err != nil {
+			t.Fatal("Couldn't append mapping: ", err)
+		}
+	}
+
+	raw, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(raw, []byte("user-1")) {
+		t.Fatal("Key file contains a plaintext user ID.")
+	}
+
+	mappings, err := k.ReadAll()
+	if err != nil {
+		t.Fatal("Couldn't read key file: ", err)
+	}
+	if len(mappings) != 2 || mappings[0].UserId != "user-1" || mappings[1].SubjectId != "subject-2" {
+		t.Fatalf("Unexpected mappings: %#v", mappings)
+	}
+
+	wrong, _ := OpenKeyFile(path, bytes.Repeat([]byte{8}, 32))
+	_, err = wrong.ReadAll()
+	if err == nil {
+		t.Fatal("Key file decrypted with the wrong key.")
+	}
+}
+
+func TestParseKey(t *testing.T) {
+	_, err := ParseKey("abcd")
+	if err == nil {
+		t.Error("Short key accepted.")
+	}
+	_, err = ParseKey("zz")
+	if err == nil {
+		t.Error("Non-hex key accepted.")
+	}
+	key, err := ParseKey("000102030405060708090a0b0c0d0e0f101112131415161718191a1b1c1d1e1f")
+	if err != nil || len(key) != 32 {
+		t.Errorf("Valid key rejected: %v", err)
+	}
+}
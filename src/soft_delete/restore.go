@@ -0,0 +1,112 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"github.com/codegangsta/cli"
+	"github.com/dabfleming/gorm"
+	"log"
+	"soft_delete/configuration"
+	"soft_delete/driver/database"
+	"soft_delete/models"
+)
+
+var restoreCommand = cli.Command{
+	Name:  "restore",
+	Usage: "Undo a user's most recent soft delete",
+	Flags: []cli.Flag{
+		cli.StringFlag{Name: "user", Usage: "UUID of the user to restore"},
+		cli.BoolFlag{Name: "admin", Usage: "allow restoring a deletion whose grace period has ended, for operators in restore_admins"},
+	},
+	Action: restoreAction,
+}
+
+func restoreAction(c *cli.Context) {
+	err := restoreUser(c.String("user"), func() error {
+		return allowFinalRestore(c.Bool("admin"), invocation.Operator)
+	})
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+// Errors unless --admin was given by an operator configured in
+// restore_admins, who is then named in the audit entry.
+func allowFinalRestore(admin bool, operator string) error {
+	if !admin {
+		return errors.New("restoring it requires --admin")
+	}
+	if !configuration.IsRestoreAdmin(operator) {
+		return fmt.Errorf("operator %q is not in restore_admins", operator)
+	}
+	return nil
+}
+
+// Restore the user's latest deletion. Finalized deletions are only restored
+// if allowFinal, the caller's check that whoever asked may, returns nil;
+// they are audited as restore_final.
+func restoreUser(userId string, allowFinal func() error) error {
+	var id models.UUID
+	id.Parse(userId)
+	if id.UUID == nil {
+		return errors.New("Error: --user must be a UUID")
+	}
+
+	// Begin TXs
+	app := database.App.Begin()
+	if app.Error != nil {
+		return app.Error
+	}
+
+	deletion, err := models.LatestDeletionWithTx(id, app)
+	if err == gorm.RecordNotFound {
+		app.Rollback()
+		return fmt.Errorf("No deletion in effect for user %v", userId)
+	} else if err != nil {
+		app.Rollback()
+		return err
+	}
+
+	var user models.User
+	err = app.Scopes(models.WithDeleted).Where("user_id = ?", id).First(&user).Error
+	if err != nil {
+		app.Rollback()
+		return fmt.Errorf("No User data for %v: %v", userId, err)
+	}
+	if !user.IsDeleted() {
+		app.Rollback()
+		return fmt.Errorf("User %v is not deleted, nothing to restore", userId)
+	}
+
+	action := models.AuditActionRestore
+	if deletion.State == models.DeletionStateFinal {
+		err = allowFinal()
+		if err != nil {
+			app.Rollback()
+			return fmt.Errorf("Deletion %v of %v was finalized on %v, %v", deletion.ID, userId, deletion.FinalizedAt.Time, err)
+		}
+		action = models.AuditActionRestoreFinal
+		log.Print("Restoring finalized deletion ", deletion.ID, " for ", invocation.Operator, ", credentials scrubbed at finalization are not recovered")
+	}
+
+	counts, err := deletion.RestoreWithTx(app)
+	if err != nil {
+		app.Rollback()
+		return fmt.Errorf("%v for user %v", err, userId)
+	}
+
+	err = audit(app, action, "restore", "", id, counts)
+	if err != nil {
+		app.Rollback()
+		return err
+	}
+
+	err = app.Commit().Error
+	if err != nil {
+		app.Rollback()
+		return err
+	}
+
+	log.Print("Successfully Restored: ", userId, " (deletion ", deletion.ID, ")")
+	return nil
+}
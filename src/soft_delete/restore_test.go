@@ -0,0 +1,25 @@
+package main
+
+import (
+	"soft_delete/configuration"
+	"testing"
+)
+
+func TestAllowFinalRestore(t *testing.T) {
+	conf := configuration.GetConfiguration()
+	defer func(saved []string) { conf.RestoreAdmins = saved }(conf.RestoreAdmins)
+	conf.RestoreAdmins = []string{"alice"}
+
+	if err := allowFinalRestore(false, "alice"); err == nil {
+		t.Fatal("Expected a finalized restore without --admin to be refused")
+	}
+	if err := allowFinalRestore(true, "mallory"); err == nil {
+		t.Fatal("Expected an operator not in restore_admins to be refused")
+	}
+	if err := allowFinalRestore(true, ""); err == nil {
+		t.Fatal("Expected a missing operator to be refused")
+	}
+	if err := allowFinalRestore(true, "alice"); err != nil {
+		t.Fatal("Expected a configured restore admin to be allowed: ", err)
+	}
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"fmt"
+	"github.com/codegangsta/cli"
+	"github.com/dabfleming/gorm"
+	"log"
+	"os"
+	"soft_delete/configuration"
+	"soft_delete/driver/database"
+	"soft_delete/models"
+	"soft_delete/research"
+	"text/tabwriter"
+	"time"
+)
+
+var finalizeCommand = cli.Command{
+	Name:  "finalize",
+	Usage: "Finalize deletions whose grace period has ended",
+	Flags: []cli.Flag{
+		cli.BoolFlag{Name: "dry-run", Usage: "list the deletions that would be finalized"},
+	},
+	Action: finalizeAction,
+}
+
+var purgeCommand = cli.Command{
+	Name:  "purge",
+	Usage: "Hard delete the rows of deletions finalized longer ago than the retention period",
+	Flags: []cli.Flag{
+		cli.BoolFlag{Name: "dry-run", Usage: "list the deletions that would be purged"},
+	},
+	Action: purgeAction,
+}
+
+var deletionsCommand = cli.Command{
+	Name:  "deletions",
+	Usage: "List deletions and their state (grace, final, restored, purged)",
+	Flags: []cli.Flag{
+		cli.StringFlag{Name: "state", Usage: "only list deletions in this state"},
+		cli.StringFlag{Name: "user", Usage: "only list deletions of this user UUID"},
+	},
+	Action: deletionsAction,
+}
+
+func finalizeAction(c *cli.Context) {
+	due, err := models.DueDeletionsWithTx(time.Now(), database.App)
+	if err != nil {
+		log.Fatal("Error listing deletions due for finalization: ", err)
+	}
+
+	pointers := configuration.GetConfiguration().ErasurePointers
+	var keyFile *research.KeyFile
+	finalize := func(d *models.Deletion, tx *gorm.DB) (models.CascadeCounts, error) {
+		// Research records are retained now rather than at quit, so the
+		// grace window's restore has nothing to move back
+		if d.RetainResearch() {
+			var err error
+			if keyFile == nil {
+				keyFile, err = research.OpenKeyFileFromEnv(configuration.GetConfiguration().Research.KeyFile)
+				if err != nil {
+					return nil, fmt.Errorf("Error opening research key file: %v", err)
+				}
+			}
+			err = pseudonymizeRecords(tx, d, keyFile)
+			if err != nil {
+				return nil, err
+			}
+		}
+		return d.FinalizeWithTx(pointers, tx)
+	}
+
+	err = eachDeletion(due, c.Bool("dry-run"), models.AuditActionFinalize, "Finalized", finalize)
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+func purgeAction(c *cli.Context) {
+	before := time.Now().Add(-configuration.RetentionPeriod())
+	purgeable, err := models.PurgeableDeletionsWithTx(before, database.App)
+	if err != nil {
+		log.Fatal("Error listing deletions due for purge: ", err)
+	}
+
+	err = eachDeletion(purgeable, c.Bool("dry-run"), models.AuditActionPurge, "Purged", (*models.Deletion).PurgeWithTx)
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+// Apply action to each deletion in its own transaction, auditing it as
+// auditAction.
+func eachDeletion(deletions []models.Deletion, dryRun bool, auditAction, verb string, action func(*models.Deletion, *gorm.DB) (models.CascadeCounts, error)) error {
+	for i := range deletions {
+		deletion := &deletions[i]
+		if dryRun {
+			log.Print("Would have ", verb, " deletion ", deletion.ID, " of ", deletion.UserId)
+			continue
+		}
+
+		app := database.App.Begin()
+		if app.Error != nil {
+			return app.Error
+		}
+
+		counts, err := action(deletion, app)
+		if models.IsLegalHold(err) {
+			app.Rollback()
+			log.Print("Skipped deletion ", deletion.ID, " (", OutcomeLegalHold, "): ", err)
+			continue
+		} else if err != nil {
+			app.Rollback()
+			return fmt.Errorf("%v for deletion %v of %v", err, deletion.ID, deletion.UserId)
+		}
+
+		err = audit(app, auditAction, fmt.Sprintf("deletion %v", deletion.ID), "", deletion.UserId, counts)
+		if err != nil {
+			app.Rollback()
+			return err
+		}
+
+		err = app.Commit().Error
+		if err != nil {
+			app.Rollback()
+			return err
+		}
+
+		log.Print(verb, " deletion ", deletion.ID, " of ", deletion.UserId)
+	}
+
+	log.Print(verb, " ", len(deletions), " deletion(s) (dry run: ", dryRun, ")")
+	return nil
+}
+
+func deletionsAction(c *cli.Context) {
+	deletions, err := models.DeletionsWithTx(c.String("state"), database.App)
+	if err != nil {
+		log.Fatal("Error listing deletions: ", err)
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tUSER\tBATCH\tSTATE\tDELETED\tGRACE UNTIL\tFINALIZED")
+	for _, d := range deletions {
+		if c.String("user") != "" && d.UserId.String() != c.String("user") {
+			continue
+		}
+		finalized := ""
+		if d.FinalizedAt.Valid {
+			finalized = d.FinalizedAt.Time.Format(time.RFC3339)
+		}
+		fmt.Fprintf(w, "%v\t%v\t%v\t%v\t%v\t%v\t%v\n", d.ID, d.UserId, d.BatchId, d.State, d.StartedAt.Format(time.RFC3339), d.GraceUntil.Format(time.RFC3339), finalized)
+	}
+	w.Flush()
+}
@@ -0,0 +1,306 @@
+package main
+
+import (
+	"fmt"
+	"github.com/codegangsta/cli"
+	"github.com/dabfleming/gorm"
+	"soft_delete/configuration"
+	"soft_delete/deprovision"
+	"soft_delete/driver/database"
+	"soft_delete/models"
+	"soft_delete/research"
+	"time"
+)
+
+// Command line options shared by the commands that delete users.
+type RunOptions struct {
+	DryRun         bool
+	RetainResearch bool
+	ExportDir      string
+	ExportZip      bool
+}
+
+func runOptions(c *cli.Context) RunOptions {
+	return RunOptions{
+		DryRun:         c.Bool("dry-run"),
+		RetainResearch: c.Bool("retain-research"),
+		ExportDir:      c.String("export-dir"),
+		ExportZip:      c.Bool("export-zip"),
+	}
+}
+
+// Settings and state shared by every row of a single run.
+type Run struct {
+	RunOptions
+	Batch  *models.DeletionBatch
+	Report *RunReport
+
+	// sha256 of the input file, if the run reads one
+	InputHash string
+
+	deprovisioners []deprovision.Deprovisioner
+
+	// Employer to the users deleted for them that should be in the
+	// employer's summary
+	departed map[string][]string
+}
+
+// Start a run reading from source. Real runs are recorded as a
+// DeletionBatch, dry runs leave no trace.
+func NewRun(source string, opts RunOptions) (*Run, error) {
+	run := &Run{
+		RunOptions: opts,
+		Batch:      &models.DeletionBatch{Source: source},
+		Report:     NewRunReport(source, opts.DryRun),
+	}
+
+	if !opts.DryRun {
+		err := invocation.Check()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// Only finalize writes to the key file, but a quit shouldn't promise
+	// retention that finalize can't deliver
+	if opts.RetainResearch {
+		_, err := research.OpenKeyFileFromEnv(configuration.GetConfiguration().Research.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("Error opening research key file: %v", err)
+		}
+	}
+
+	deprovisioners, err := newDeprovisioners(configuration.GetConfiguration().Providers)
+	if err != nil {
+		return nil, err
+	}
+	run.deprovisioners = deprovisioners
+
+	if opts.DryRun {
+		return run, nil
+	}
+
+	batch, err := models.NewDeletionBatch(source, invocation.Metadata(), database.App)
+	if err != nil {
+		return nil, err
+	}
+	run.Batch = batch
+	return run, nil
+}
+
+// Soft delete user within app and commit. The offboarding log and status
+// are left in place, the log recording meta (row, employer and the like)
+// with the run's source and invocation. When dry running, roll back
+// without touching anything instead. Held users are refused either way.
+func (run *Run) commitDeletion(app *gorm.DB, user models.User, meta models.Metadata) (string, error) {
+	err := user.CheckLegalHoldWithTx(app)
+	if err != nil {
+		app.Rollback()
+		return outcomeFor(err), err
+	}
+
+	if run.DryRun {
+		app.Rollback()
+		return OutcomePreview, nil
+	}
+
+	err = user.CompletePendingDeletionsWithTx(app)
+	if err != nil {
+		app.Rollback()
+		return OutcomeError, err
+	}
+
+	logMeta := invocation.Metadata()
+	logMeta["source"] = run.Batch.Source
+	logMeta["batch_id"] = run.Batch.ID
+	for key, value := range meta {
+		logMeta[key] = value
+	}
+	keep, err := user.MarkQuitWithTx(logMeta, app)
+	if err != nil {
+		app.Rollback()
+		return OutcomeError, err
+	}
+
+	err = run.recordReason(app, user, meta)
+	if err != nil {
+		app.Rollback()
+		return OutcomeError, err
+	}
+
+	deletion, err := user.GraceDeleteWithTx(run.Batch.ID, configuration.GracePeriod(), keep, app)
+	if err != nil {
+		app.Rollback()
+		return outcomeFor(err), err
+	}
+
+	// Research records are only moved at finalize, so a restore in the
+	// grace window finds them where they were
+	if run.RetainResearch {
+		err = deletion.AddMetaWithTx(models.Metadata{"retain_research": true}, app)
+		if err != nil {
+			app.Rollback()
+			return OutcomeError, err
+		}
+	}
+
+	jobs, err := run.enqueueSideEffects(app, user, meta)
+	if err != nil {
+		app.Rollback()
+		return OutcomeError, err
+	}
+
+	err = audit(app, models.AuditActionQuit, run.Batch.Source, run.InputHash, user.UserId, deletion.Counts())
+	if err != nil {
+		app.Rollback()
+		return OutcomeError, err
+	}
+
+	err = app.Commit().Error
+	if err != nil {
+		app.Rollback()
+		return OutcomeError, err
+	}
+
+	for _, job := range jobs {
+		run.Report.SideEffect(user.UserId, fmt.Sprintf("queued %v job %v", job.Type, job.ID))
+	}
+	if employer, _ := meta["employer"].(string); employer != "" && shouldNotify(meta) {
+		if run.departed == nil {
+			run.departed = make(map[string][]string)
+		}
+		run.departed[employer] = append(run.departed[employer], user.UserId.String())
+	}
+	return OutcomeDeleted, nil
+}
+
+// Queue the deletion's side effects (exports, deprovisioning, the
+// participant's notification) within app, so they are only run, by the job
+// worker, if the deletion commits.
+func (run *Run) enqueueSideEffects(app *gorm.DB, user models.User, meta models.Metadata) ([]*models.Job, error) {
+	jobs, err := enqueueDeprovisioning(app, user, run.deprovisioners)
+	if err != nil {
+		return nil, err
+	}
+
+	if run.ExportDir != "" {
+		job, err := enqueueExport(app, user, run.ExportDir, run.ExportZip)
+		if err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, job)
+	}
+
+	if shouldNotify(meta) {
+		job, err := enqueueParticipantNotification(app, user, meta)
+		if err != nil {
+			return nil, err
+		}
+		jobs = append(jobs, job)
+	}
+	return jobs, nil
+}
+
+// Hold user's deletion until effective and commit. When dry running, roll
+// back without touching anything instead. Held users are refused either way.
+func (run *Run) scheduleDeletion(app *gorm.DB, user models.User, effective time.Time, meta models.Metadata) (string, error) {
+	err := user.CheckLegalHoldWithTx(app)
+	if err != nil {
+		app.Rollback()
+		return outcomeFor(err), err
+	}
+
+	if run.DryRun {
+		app.Rollback()
+		return OutcomePreview, nil
+	}
+
+	_, replaced, err := user.ScheduleDeletionWithTx(run.Batch.ID, effective, meta, app)
+	if err != nil {
+		app.Rollback()
+		return outcomeFor(err), err
+	}
+
+	err = run.recordReason(app, user, meta)
+	if err != nil {
+		app.Rollback()
+		return OutcomeError, err
+	}
+
+	err = app.Commit().Error
+	if err != nil {
+		app.Rollback()
+		return OutcomeError, err
+	}
+
+	if replaced {
+		return OutcomeRescheduled, nil
+	}
+	return OutcomeScheduled, nil
+}
+
+// Add the reason and notes in meta, if any, to the batch metadata.
+func (run *Run) recordReason(app *gorm.DB, user models.User, meta models.Metadata) error {
+	reason, _ := meta["reason"].(string)
+	if reason == "" {
+		return nil
+	}
+	notes, _ := meta["notes"].(string)
+
+	err := run.Batch.AddReasonWithTx(user.UserId, reason, notes, app)
+	if err != nil {
+		return fmt.Errorf("Error recording reason: %v", err)
+	}
+	return nil
+}
+
+// Move the research records of deletion's user to a new pseudonymous
+// subject, recording the mapping only in the encrypted key file. The
+// mapping is written before the transaction commits, so a failed commit
+// can at worst leave a mapping to a subject that doesn't exist.
+func pseudonymizeRecords(app *gorm.DB, deletion *models.Deletion, keyFile *research.KeyFile) error {
+	conf := configuration.GetConfiguration().Research
+
+	var subject models.UUID
+	subject.New()
+
+	moved, err := deletion.PseudonymizeRecordsWithTx(subject, conf.Entities, conf.MetaAllowlist, app)
+	if err != nil {
+		return fmt.Errorf("Error retaining research records: %v", err)
+	}
+	if moved == 0 {
+		return nil
+	}
+
+	err = keyFile.Append(research.Mapping{
+		UserId:    deletion.UserId.String(),
+		SubjectId: subject.String(),
+		CreatedAt: time.Now(),
+	})
+	if err != nil {
+		return fmt.Errorf("Error writing research key file: %v", err)
+	}
+	return nil
+}
+
+// Run fn in a transaction, committing if it returns nil and rolling back
+// otherwise.
+func inTransaction(fn func(app *gorm.DB) error) error {
+	app := database.App.Begin()
+	if app.Error != nil {
+		return app.Error
+	}
+
+	err := fn(app)
+	if err != nil {
+		app.Rollback()
+		return err
+	}
+
+	err = app.Commit().Error
+	if err != nil {
+		app.Rollback()
+		return err
+	}
+	return nil
+}
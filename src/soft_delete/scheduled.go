@@ -0,0 +1,141 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"github.com/codegangsta/cli"
+	"log"
+	"soft_delete/driver/database"
+	"soft_delete/models"
+	"time"
+)
+
+var runScheduledCommand = cli.Command{
+	Name:  "run-scheduled",
+	Usage: "Soft delete every participant whose scheduled quit date has passed",
+	Flags: []cli.Flag{
+		cli.BoolFlag{Name: "dry-run", Usage: "list the due deletions, but delete nothing"},
+		cli.StringFlag{Name: "report", Usage: "write the per-row report to this CSV file"},
+		cli.BoolFlag{Name: "retain-research", Usage: "keep configured health records under a pseudonymous subject instead of deleting them"},
+	},
+	Action: runScheduledAction,
+}
+
+var cancelPendingCommand = cli.Command{
+	Name:  "cancel-pending",
+	Usage: "Cancel scheduled quits for a user or for a whole batch",
+	Flags: []cli.Flag{
+		cli.StringFlag{Name: "user", Usage: "UUID of the user whose pending deletions to cancel"},
+		cli.IntFlag{Name: "batch", Usage: "ID of the deletion batch whose pending deletions to cancel"},
+	},
+	Action: cancelPendingAction,
+}
+
+func runScheduledAction(c *cli.Context) {
+	run, err := runScheduledDeletions(runOptions(c))
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	err = run.Finish(c.String("report"))
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+func runScheduledDeletions(opts RunOptions) (*Run, error) {
+	due, err := models.DuePendingDeletionsWithTx(time.Now(), database.App)
+	if err != nil {
+		return nil, fmt.Errorf("Error listing due deletions: %v", err)
+	}
+
+	run, err := NewRun("scheduled", opts)
+	if err != nil {
+		return nil, err
+	}
+
+	for i, pending := range due {
+		run.Report.Add(run.executePendingDeletion(pending, i+1))
+	}
+	return run, nil
+}
+
+func (run *Run) executePendingDeletion(pending models.PendingDeletion, row int) RowResult {
+	result := RowResult{
+		Row:    row,
+		UserId: pending.UserId.String(),
+	}
+	// Only resolved employers were recorded when the quit was scheduled
+	result.Employer, _ = pending.Meta["employer"].(string)
+
+	// Begin TXs
+	app := database.App.Begin()
+	if app.Error != nil {
+		log.Fatalf("Error starting transaction(s).\n\tApp: %v\n", app.Error)
+	}
+
+	participant := models.User{UserId: pending.UserId}
+	// Scheduling recorded where the quit came from and the status to restore
+	meta := models.Metadata{"pending_id": pending.ID}
+	for key, value := range pending.Meta {
+		meta[key] = value
+	}
+	outcome, err := run.commitDeletion(app, participant, meta)
+	if err != nil {
+		return result.with(outcome, err, " for scheduled deletion ", pending.ID, " of Person: ", pending.UserId)
+	}
+	if outcome == OutcomePreview {
+		return result.with(outcome, "Would Soft-Delete (due ", pending.EffectiveDate.Format(effectiveDateFormat), "): ", pending.UserId)
+	}
+	return result.with(outcome, "Successfully Soft-Deleted (due ", pending.EffectiveDate.Format(effectiveDateFormat), "): ", pending.UserId)
+}
+
+func cancelPendingAction(c *cli.Context) {
+	err := cancelPending(c.String("user"), c.Int("batch"))
+	if err != nil {
+		log.Fatal(err)
+	}
+}
+
+func cancelPending(userId string, batchId int) error {
+	if (userId == "") == (batchId == 0) {
+		return errors.New("Error: give exactly one of --user or --batch")
+	}
+
+	query := database.App.Where("status = ?", models.PendingStatusPending)
+	if userId != "" {
+		query = query.Where("user_id = ?", userId)
+	} else {
+		query = query.Where("batch_id = ?", batchId)
+	}
+
+	var pending []models.PendingDeletion
+	err := query.Find(&pending).Error
+	if err != nil {
+		return fmt.Errorf("Error listing pending deletions: %v", err)
+	}
+
+	for i := range pending {
+		app := database.App.Begin()
+		if app.Error != nil {
+			return app.Error
+		}
+
+		err = pending[i].CancelWithTx(app)
+		if err != nil {
+			app.Rollback()
+			return fmt.Errorf("Error cancelling pending deletion %v of %v: %v", pending[i].ID, pending[i].UserId, err)
+		}
+
+		err = app.Commit().Error
+		if err != nil {
+			app.Rollback()
+			return err
+		}
+
+		log.Print("Cancelled scheduled deletion ", pending[i].ID, " of ", pending[i].UserId, " (was due ", pending[i].EffectiveDate.Format(effectiveDateFormat), ")")
+	}
+
+	log.Print("Cancelled ", len(pending), " pending deletion(s)")
+	return nil
+}
@@ -1,18 +1,21 @@
 package main
 
 import (
-	"soft_delete/driver/database"
-	//"github.com/codegangsta/cli"
 	"encoding/csv"
 	"errors"
 	"fmt"
+	"github.com/codegangsta/cli"
+	"github.com/dabfleming/gorm"
 	jp "github.com/dustin/go-jsonpointer"
 	"io"
 	"log"
 	"os"
 	"path/filepath"
+	"soft_delete/configuration"
+	"soft_delete/driver/database"
 	"soft_delete/models"
 	"strings"
+	"time"
 )
 
 type QuitRecord struct {
@@ -20,40 +23,123 @@ type QuitRecord struct {
 	LastName  string `json:"-"` //col 1
 	Email     string `json:"-"` //col 2
 	Company   string `json:"-"` //col 3
-	//SoftDeleted string `json:"-"` //col 4
+
+	// Optional, located by header name
+	EffectiveDate time.Time `json:"-"` //effective_date
+	Reason        string    `json:"-"` //reason, a configured reason code
+	Notes         string    `json:"-"` //notes
 }
 
+// Date format of the quit list's effective_date column
+const effectiveDateFormat = "2006-01-02"
+
 func main() {
+	app := cli.NewApp()
+	app.Name = "soft_delete"
+	app.Usage = "Offboard and soft delete Newtopia users"
+	app.Version = buildIdOrUnknown()
+	app.Flags = []cli.Flag{
+		cli.StringFlag{Name: "operator", Usage: "who is running this, defaults to $" + operatorEnv + " (required in production)"},
+	}
+	app.Before = func(c *cli.Context) error {
+		invocation = newInvocation(c.GlobalString("operator"))
+		return nil
+	}
+	app.Commands = []cli.Command{
+		{
+			Name:  "quit",
+			Usage: "Soft delete every participant listed in a quit CSV",
+			Flags: []cli.Flag{
+				cli.StringFlag{Name: "file", Value: "quit.csv", Usage: "quit list (first_name, last_name, email, company[, effective_date, reason, notes])"},
+				cli.BoolFlag{Name: "dry-run", Usage: "match every row and report, but delete nothing"},
+				cli.StringFlag{Name: "report", Usage: "write the per-row report to this CSV file"},
+				cli.StringFlag{Name: "employer-reports", Usage: "write a CSV and HTML report per employer, and one of unresolved rows, to this directory"},
+				cli.BoolFlag{Name: "retain-research", Usage: "keep configured health records under a pseudonymous subject instead of deleting them"},
+				cli.StringFlag{Name: "export-dir", Usage: "queue an export of each deleted user's data to this directory (run by jobs work)"},
+				cli.BoolFlag{Name: "export-zip", Usage: "write exports as zip files instead of directories"},
+			},
+			Action: quitCommand,
+		},
+		offboardCoachCommand,
+		offboardEmployerCommand,
+		reconcileCommand,
+		runScheduledCommand,
+		cancelPendingCommand,
+		restoreCommand,
+		finalizeCommand,
+		purgeCommand,
+		deletionsCommand,
+		eraseCommand,
+		exportCommand,
+		accessReportCommand,
+		inspectCommand,
+		holdCommand,
+		consentCommand,
+		auditCommand,
+		dispatchCommand,
+		serveHRCommand,
+		hrEventsCommand,
+		serveAdminCommand,
+		jobsCommand,
+		checkCommand,
+		versionCommand,
+	}
+
+	app.Run(os.Args)
+}
 
+func quitCommand(c *cli.Context) {
 	log.Print("Load Data from CSV")
 
-	err := softDeleteQuitList("quit.csv")
+	run, err := softDeleteQuitList(c.String("file"), runOptions(c))
+	if err != nil {
+		panic(err)
+	}
+
+	err = run.Finish(c.String("report"))
 	if err != nil {
 		panic(err)
 	}
 
+	if c.String("employer-reports") != "" {
+		err = writeEmployerReports(run.Report, c.String("employer-reports"))
+		if err != nil {
+			panic(err)
+		}
+	}
+
 	log.Print("End Soft Delete Quitters")
-	return
 }
 
-func softDeleteQuitList(filename string) (err error) {
+func softDeleteQuitList(filename string, opts RunOptions) (run *Run, err error) {
 
 	//Check if CSV file
 	ext := filepath.Ext(filename)
 	if ext != ".csv" {
 		err := errors.New("Error: Input file is not .csv")
-		return err
+		return nil, err
 	}
 
 	//Open File
 	file, err := os.Open(filename)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	defer file.Close()
 
 	r := csv.NewReader(file)
+	r.FieldsPerRecord = -1
+
+	run, err = NewRun(filename, opts)
+	if err != nil {
+		return nil, err
+	}
+	run.InputHash, err = fileHash(filename)
+	if err != nil {
+		return nil, err
+	}
 
+	var columns map[string]int
 	for i := 0; ; i++ {
 		var qRecord QuitRecord
 
@@ -61,11 +147,17 @@ func softDeleteQuitList(filename string) (err error) {
 		if err == io.EOF {
 			break
 		} else if err != nil {
-			return err
+			return nil, err
 		}
 
-		//Skip header row
+		//Header row names the optional columns
 		if i == 0 {
+			columns = headerColumns(row)
+			continue
+		}
+
+		if len(row) < 4 {
+			run.Report.Add(RowResult{Row: i}.with(OutcomeInvalid, "Row ", i, " has ", len(row), " column(s), expected at least 4"))
 			continue
 		}
 
@@ -74,130 +166,147 @@ func softDeleteQuitList(filename string) (err error) {
 			LastName:  row[1],
 			Email:     row[2],
 			Company:   row[3],
-			//SoftDeleted: row[4],
 		}
 
-		// Begin TXs
-		app := database.App.Begin()
-		if app.Error != nil {
-			log.Fatalf("Error starting transaction(s).\n\tApp: %v\n", app.Error)
-			err = app.Error
-			return err
+		if date := optionalColumn(row, columns, "effective_date"); date != "" {
+			qRecord.EffectiveDate, err = time.ParseInLocation(effectiveDateFormat, date, time.Local)
+			if err != nil {
+				run.Report.Add(RowResult{Row: i, Email: qRecord.Email}.with(OutcomeInvalid, "Invalid effective_date for ", qRecord.Email, ": ", date, " ~ Err: ", err))
+				continue
+			}
 		}
 
-		//Grab UUID from user_emails via email
-		var userEmail models.UserEmail
-		err = app.Where("email = ?", qRecord.Email).Find(&userEmail).Error
-		if err != nil {
-			app.Rollback()
-			log.Print("No Email data for this participant: ", qRecord.FirstName, " ", qRecord.LastName, ", ", qRecord.Email, " ~ Err: ", err)
+		qRecord.Reason = strings.ToLower(optionalColumn(row, columns, "reason"))
+		qRecord.Notes = optionalColumn(row, columns, "notes")
+		if _, ok := configuration.Reason(qRecord.Reason); qRecord.Reason != "" && !ok {
+			run.Report.Add(RowResult{Row: i, Email: qRecord.Email}.with(OutcomeInvalid, "Unknown reason for ", qRecord.Email, ": ", qRecord.Reason))
 			continue
 		}
 
-		//Grab Intake Record to compare name, with UUID from user_emails
-		var userRecord models.Record
-		err = app.Where("user_id = ? and entity_id in (SELECT id from entities where name = 'Intake')", userEmail.UserId).Find(&userRecord).Error
-		if err != nil {
-			app.Rollback()
-			log.Print("No Intake Record data for this participant: ", qRecord.FirstName, " ", qRecord.LastName, ", ", qRecord.Email, " - with UserId: ", userEmail.UserId, " ~ Err: ", err)
-			continue
-		}
+		run.Report.Add(run.quitParticipant(qRecord, i))
+	}
+	return run, nil
 
-		FName := fmt.Sprintf("%v", jp.Get(userRecord.Meta, "/first_name"))
-		LName := fmt.Sprintf("%v", jp.Get(userRecord.Meta, "/last_name"))
+}
 
-		if strings.ToUpper(FName) != strings.ToUpper(qRecord.FirstName) || strings.ToUpper(LName) != strings.ToUpper(qRecord.LastName) {
-			app.Rollback()
-			log.Print("Intake Record Names did not match: ", qRecord.FirstName, " ", qRecord.LastName, ", and from file:  ", FName, " ", LName)
-			continue
-		}
+// Match one quit list row to a participant and soft delete them, or
+// schedule the deletion if the row has a future effective date.
+func (run *Run) quitParticipant(qRecord QuitRecord, row int) RowResult {
+	result := RowResult{
+		Row:       row,
+		FirstName: qRecord.FirstName,
+		LastName:  qRecord.LastName,
+		Email:     qRecord.Email,
+		Company:   qRecord.Company,
+	}
 
-		//Make sure Association is correct
-		var employer models.User
-		var userAssociation models.Association
+	// Begin TXs
+	app := database.App.Begin()
+	if app.Error != nil {
+		log.Fatalf("Error starting transaction(s).\n\tApp: %v\n", app.Error)
+	}
 
-		err = app.Where("display_name = ?", qRecord.Company).Find(&employer).Error
-		if err != nil {
-			app.Rollback()
-			log.Print("No User data for this Company: ", qRecord.Company, " ~ Err: ", err)
-			continue
-		}
+	//Grab UUID from user_emails via email
+	var userEmail models.UserEmail
+	err := app.Where("email = ?", qRecord.Email).Find(&userEmail).Error
+	if err != nil {
+		app.Rollback()
+		return result.with(OutcomeNoEmail, "No Email data for this participant: ", qRecord.FirstName, " ", qRecord.LastName, ", ", qRecord.Email, " ~ Err: ", err)
+	}
+	result.UserId = userEmail.UserId.String()
 
-		err = app.Where("type = 'participant:employer' and (users #>> '{participant}')::uuid = ? and (users #>> '{employer}')::uuid = ?", userEmail.UserId, employer.UserId).Find(&userAssociation).Error
-		if err != nil {
-			app.Rollback()
-			log.Print("No Employer Association for this Person:", qRecord.FirstName, " ", qRecord.LastName, " and this Company: ", qRecord.Company, " ~ Err: ", err)
-			continue
-		}
+	//Grab Intake Record to compare name, with UUID from user_emails
+	FName, LName, err := intakeNames(app, userEmail.UserId)
+	if err != nil {
+		app.Rollback()
+		return result.with(OutcomeNoIntake, "No Intake Record data for this participant: ", qRecord.FirstName, " ", qRecord.LastName, ", ", qRecord.Email, " - with UserId: ", userEmail.UserId, " ~ Err: ", err)
+	}
 
-		//If we have reached here, we can soft delete all records based on userEmail.UserId
-		err = app.Where("user_id = ?", userEmail.UserId).Delete(&models.User{}).Error
-		if err != nil {
-			app.Rollback()
-			log.Print("Error Deleting user for Person:", qRecord.FirstName, " ", qRecord.LastName, " and this Company: ", qRecord.Company, " ~ Err: ", err)
-			continue
-		}
+	if strings.ToUpper(FName) != strings.ToUpper(qRecord.FirstName) || strings.ToUpper(LName) != strings.ToUpper(qRecord.LastName) {
+		app.Rollback()
+		return result.with(OutcomeNameMismatch, "Intake Record Names did not match: ", qRecord.FirstName, " ", qRecord.LastName, ", and from file:  ", FName, " ", LName)
+	}
 
-		err = app.Where("user_id = ?", userEmail.UserId).Delete(&models.UserState{}).Error
-		if err != nil {
-			app.Rollback()
-			log.Print("Error Deleting user_states for Person:", qRecord.FirstName, " ", qRecord.LastName, " and this Company: ", qRecord.Company, " ~ Err: ", err)
-			continue
-		}
+	//Make sure Association is correct
+	var employer models.User
+	var userAssociation models.Association
 
-		err = app.Where("user_id = ?", userEmail.UserId).Delete(&models.UserSettings{}).Error
-		if err != nil {
-			app.Rollback()
-			log.Print("Error Deleting user_settings for Person:", qRecord.FirstName, " ", qRecord.LastName, " and this Company: ", qRecord.Company, " ~ Err: ", err)
-			continue
-		}
+	err = app.Where("display_name = ?", qRecord.Company).Find(&employer).Error
+	if err != nil {
+		app.Rollback()
+		return result.with(OutcomeNoEmployer, "No User data for this Company: ", qRecord.Company, " ~ Err: ", err)
+	}
+	result.Employer = employer.DisplayName
 
-		err = app.Where("user_id = ?", userEmail.UserId).Delete(&models.UserEmail{}).Error
-		if err != nil {
-			app.Rollback()
-			log.Print("Error Deleting user_emails for Person:", qRecord.FirstName, " ", qRecord.LastName, " and this Company: ", qRecord.Company, " ~ Err: ", err)
-			continue
-		}
+	err = app.Where("type = 'participant:employer' and (users #>> '{participant}')::uuid = ? and (users #>> '{employer}')::uuid = ?", userEmail.UserId, employer.UserId).Find(&userAssociation).Error
+	if err != nil {
+		app.Rollback()
+		return result.with(OutcomeNoAssociation, "No Employer Association for this Person:", qRecord.FirstName, " ", qRecord.LastName, " and this Company: ", qRecord.Company, " ~ Err: ", err)
+	}
 
-		err = app.Where("user_id = ?", userEmail.UserId).Delete(&models.UserLog{}).Error
-		if err != nil {
-			app.Rollback()
-			log.Print("Error Deleting user_logs for Person:", qRecord.FirstName, " ", qRecord.LastName, " and this Company: ", qRecord.Company, " ~ Err: ", err)
-			continue
-		}
+	//If we have reached here, we can soft delete all records based on userEmail.UserId
+	participant := models.User{UserId: userEmail.UserId}
 
-		err = app.Where("user_id = ?", userEmail.UserId).Delete(&models.UserAddress{}).Error
-		if err != nil {
-			app.Rollback()
-			log.Print("Error Deleting user_addresses for Person:", qRecord.FirstName, " ", qRecord.LastName, " and this Company: ", qRecord.Company, " ~ Err: ", err)
-			continue
-		}
+	//External providers (Validic) are deprovisioned by the job worker once the deletion commits, see Run.enqueueSideEffects
 
-		err = app.Where("(users #>> '{participant}')::uuid = ?", userEmail.UserId).Delete(&models.Association{}).Error
-		if err != nil {
-			app.Rollback()
-			log.Print("Error Deleting associations for Person:", qRecord.FirstName, " ", qRecord.LastName, " and this Company: ", qRecord.Company, " ~ Err: ", err)
-			continue
-		}
+	meta := models.Metadata{"row": row, "employer": employer.DisplayName}
+	if qRecord.Reason != "" {
+		meta["reason"] = qRecord.Reason
+	}
+	if qRecord.Notes != "" {
+		meta["notes"] = qRecord.Notes
+	}
 
-		err = app.Where("user_id = ?", userEmail.UserId).Delete(&models.Record{}).Error
+	if qRecord.EffectiveDate.After(time.Now()) {
+		meta["source"] = run.Batch.Source
+		outcome, err := run.scheduleDeletion(app, participant, qRecord.EffectiveDate, meta)
 		if err != nil {
-			app.Rollback()
-			log.Print("Error Deleting records for Person:", qRecord.FirstName, " ", qRecord.LastName, " and this Company: ", qRecord.Company, " ~ Err: ", err)
-			continue
+			return result.with(outcome, err, " scheduling Person:", qRecord.FirstName, " ", qRecord.LastName, " and this Company: ", qRecord.Company)
+		}
+		verb := "Scheduled"
+		if outcome == OutcomeRescheduled {
+			verb = "Rescheduled"
 		}
+		return result.with(outcome, verb, " Soft-Delete on ", qRecord.EffectiveDate.Format(effectiveDateFormat), ": ", userEmail.UserId, " - ", qRecord.FirstName, " ", qRecord.LastName, ", ", qRecord.Email)
+	}
 
-		//Has not yet touched Validic? I don't know what's going on with that?
+	outcome, err := run.commitDeletion(app, participant, meta)
+	if err != nil {
+		return result.with(outcome, err, " for Person:", qRecord.FirstName, " ", qRecord.LastName, " and this Company: ", qRecord.Company)
+	}
+	if outcome == OutcomePreview {
+		return result.with(outcome, "Would Soft-Delete: ", userEmail.UserId, " - ", qRecord.FirstName, " ", qRecord.LastName, ", ", qRecord.Email)
+	}
+	return result.with(outcome, "Successfully Soft-Deleted: ", userEmail.UserId, " - ", qRecord.FirstName, " ", qRecord.LastName, ", ", qRecord.Email)
+}
 
-		err = app.Commit().Error
-		if err != nil {
-			app.Rollback()
-			continue
-		}
+// Returns the first and last name recorded on the user's Intake Record.
+func intakeNames(app *gorm.DB, userId models.UUID) (first, last string, err error) {
+	var userRecord models.Record
+	err = app.Where("user_id = ? and entity_id in (SELECT id from entities where name = 'Intake')", userId).Find(&userRecord).Error
+	if err != nil {
+		return "", "", err
+	}
 
-		log.Print("Successfully Soft-Deleted: ", userEmail.UserId, " - ", qRecord.FirstName, " ", qRecord.LastName, ", ", qRecord.Email)
+	first = fmt.Sprintf("%v", jp.Get(userRecord.Meta, "/first_name"))
+	last = fmt.Sprintf("%v", jp.Get(userRecord.Meta, "/last_name"))
+	return first, last, nil
+}
 
+// Maps each header name, lower cased, to its column index.
+func headerColumns(header []string) map[string]int {
+	columns := make(map[string]int)
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
 	}
-	return err
+	return columns
+}
 
+// Returns the named column of row, "" if the file doesn't have it.
+func optionalColumn(row []string, columns map[string]int, name string) string {
+	i, ok := columns[name]
+	if !ok || i >= len(row) {
+		return ""
+	}
+	return strings.TrimSpace(row[i])
 }